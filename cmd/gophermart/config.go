@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/learies/gofermart/internal/config"
+)
+
+const configUsage = `Usage: gophermart [-config FILE] [flags] config <command>
+
+Commands:
+  print      show the effective configuration, with secrets masked
+  validate   check the configuration without starting the server
+`
+
+func runConfig(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("missing config command")
+	}
+
+	switch args[0] {
+	case "print":
+		if err := cfg.Print(os.Stdout); err != nil {
+			return err
+		}
+		// The configuration is printed even when it is invalid, since that
+		// is when it is most needed.
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		return nil
+	case "validate":
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		fmt.Println("Configuration is valid")
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, configUsage)
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
@@ -1,25 +1,78 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
 	"github.com/learies/gofermart/internal/app"
+	"github.com/learies/gofermart/internal/buildinfo"
 	"github.com/learies/gofermart/internal/config"
 	"github.com/learies/gofermart/internal/config/logger"
 )
 
 func main() {
-	cfg := config.NewConfig()
+	cfg, err := config.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		os.Exit(2)
+	}
 
-	err := logger.NewLogger("info")
+	if flag.Arg(0) == "config" {
+		if err := runConfig(cfg, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	err = logger.NewLogger(logger.Options{
+		Level:        cfg.LogLevel,
+		Format:       cfg.LogFormat,
+		Output:       cfg.LogOutput,
+		MaxSizeMB:    cfg.LogMaxSizeMB,
+		MaxBackups:   cfg.LogMaxBackups,
+		RedactFields: cfg.LogRedactFields,
+	})
 	if err != nil {
-		logger.Log.Error("Could not create logger", "error", err)
+		fmt.Fprintln(os.Stderr, "Could not create logger:", err)
+		os.Exit(1)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg, flag.Args()[1:]); err != nil {
+			logger.Log.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "admin" {
+		if err := runAdmin(cfg, flag.Args()[1:]); err != nil {
+			logger.Log.Error("Admin command failed", "error", err)
+			os.Exit(1)
+		}
+		return
 	}
 
+	// Migrations and admin commands only need the database, so the rest is
+	// checked afterwards.
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	build := buildinfo.Get()
+	logger.Log.Info("Starting gophermart", "version", build.Version, "commit", build.Commit, "go_version", build.GoVersion)
+
 	application, err := app.NewApp(cfg)
 	if err != nil {
 		logger.Log.Error("Could not create app", "error", err)
+		os.Exit(1)
 	}
 
 	if err := application.Run(); err != nil {
-		logger.Log.Error("Could not start server", "error", err)
+		logger.Log.Error("Server stopped with an error", "error", err)
+		os.Exit(1)
 	}
 }
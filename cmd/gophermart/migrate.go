@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/learies/gofermart/internal/config"
+	"github.com/learies/gofermart/internal/storage/postgres"
+	"github.com/learies/gofermart/internal/storage/sqlite"
+)
+
+const migrateUsage = `Usage: gophermart [-d DSN] migrate [-dry-run] <command>
+
+Commands:
+  up [VERSION]   apply pending migrations, up to VERSION if given
+  down [STEPS]   revert the last STEPS migrations (default 1)
+  status         list migrations and when they were applied
+
+SQLite databases support up only.
+`
+
+func runMigrate(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of executing it")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), migrateUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing migrate command")
+	}
+
+	ctx := context.Background()
+
+	if sqlite.IsDSN(cfg.DatabaseURI) {
+		return migrateSQLite(ctx, cfg.DatabaseURI, fs.Args(), *dryRun)
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.DatabaseURI)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := postgres.NewMigrator(pool, *dryRun, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "up":
+		var target int64
+		if fs.NArg() > 1 {
+			if target, err = strconv.ParseInt(fs.Arg(1), 10, 64); err != nil {
+				return fmt.Errorf("invalid version %q", fs.Arg(1))
+			}
+		}
+		return migrator.Up(ctx, target)
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			if steps, err = strconv.Atoi(fs.Arg(1)); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", fs.Arg(1))
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+}
+
+// migrateSQLite supports up only: SQLite migrations have no down scripts.
+func migrateSQLite(ctx context.Context, dsn string, args []string, dryRun bool) error {
+	if args[0] != "up" || len(args) > 1 || dryRun {
+		return fmt.Errorf("SQLite supports migrate up only, without a version or -dry-run")
+	}
+
+	db, err := sqlite.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return sqlite.Migrate(ctx, db)
+}
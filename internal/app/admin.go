@@ -0,0 +1,85 @@
+package app
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+
+	"github.com/learies/gofermart/internal/buildinfo"
+	"github.com/learies/gofermart/internal/certs"
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/metrics"
+	"github.com/learies/gofermart/internal/middleware"
+)
+
+// newAdminServer serves the metrics and the runtime diagnostics. It is only
+// reachable with the admin token, a client certificate from the admin CAs, or
+// both when both are configured.
+func (a *App) newAdminServer(tlsConfig *tls.Config) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/goroutines", goroutineDump)
+	mux.HandleFunc("/debug/buildinfo", buildInfo)
+	mux.HandleFunc("/debug/config", a.currentConfig)
+
+	var handler http.Handler = mux
+	if a.Config.AdminToken != "" {
+		handler = middleware.AdminToken(a.Config.AdminToken)(handler)
+	}
+	server := &http.Server{Addr: a.Config.AdminAddress, Handler: handler}
+
+	if tlsConfig != nil {
+		var err error
+		if server.TLSConfig, err = withClientCAs(tlsConfig, a.Config.AdminClientCAFile); err != nil {
+			return nil, fmt.Errorf("load admin client CAs: %w", err)
+		}
+	}
+	return server, nil
+}
+
+// withClientCAs clones tlsConfig, requiring a client certificate issued by
+// the CAs in caFile when it is set.
+func withClientCAs(tlsConfig *tls.Config, caFile string) (*tls.Config, error) {
+	clone := tlsConfig.Clone()
+	if caFile == "" {
+		return clone, nil
+	}
+	clientCAs, err := certs.LoadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	clone.ClientCAs = clientCAs
+	clone.ClientAuth = tls.RequireAndVerifyClientCert
+	return clone, nil
+}
+
+// goroutineDump writes the stack of every goroutine, as in a crash report.
+func goroutineDump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := runtimepprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		logger.Log.ErrorContext(r.Context(), "Failed to dump goroutines", "error", err)
+	}
+}
+
+func buildInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildinfo.Get())
+}
+
+// currentConfig writes the configuration in effect, reloaded settings
+// included, with secrets masked.
+func (a *App) currentConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := a.runtimeConfig.Load().Print(w); err != nil {
+		logger.Log.ErrorContext(r.Context(), "Failed to print configuration", "error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/learies/gofermart/internal/certs/certstest"
+	"github.com/learies/gofermart/internal/config"
+	"github.com/learies/gofermart/internal/lifecycle"
+)
+
+const testAdminToken = "admin-token-0123456789"
+
+func newTestApp(cfg *config.Config) *App {
+	a := &App{Config: cfg}
+	a.runtimeConfig.Store(cfg)
+	return a
+}
+
+func TestAdminServerToken(t *testing.T) {
+	a := newTestApp(&config.Config{
+		AdminAddress: "localhost:0",
+		AdminToken:   testAdminToken,
+		JWTSecret:    "test-jwt-secret-0123456789abcdef0123",
+		LogLevel:     "info",
+	})
+	server, err := a.newAdminServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.TLSConfig != nil {
+		t.Error("admin listener serves TLS although the API does not")
+	}
+
+	for _, path := range []string{"/metrics", "/debug/pprof/", "/debug/goroutines", "/debug/buildinfo", "/debug/config"} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("without token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			rec = httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("with token: status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if path == "/debug/config" && (strings.Contains(rec.Body.String(), testAdminToken) || strings.Contains(rec.Body.String(), a.Config.JWTSecret)) {
+				t.Errorf("configuration shows a secret:\n%s", rec.Body)
+			}
+		})
+	}
+}
+
+// startAdminServer serves the admin listener of cfg over TLS with a server
+// certificate from ca, and returns its URL.
+func startAdminServer(t *testing.T, ca *certstest.CA, cfg *config.Config) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	pair := ca.Server(t, 1)
+	cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSMinVersion = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), "1.2"
+	for file, data := range map[string][]byte{cfg.TLSCertFile: pair.CertPEM, cfg.TLSKeyFile: pair.KeyPEM} {
+		if err := os.WriteFile(file, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(cfg, lifecycle.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := newTestApp(cfg).newAdminServer(tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AdminClientCAFile != "" && tlsConfig.ClientAuth != tls.NoClientCert {
+		t.Error("the admin client CAs leaked into the TLS configuration of the API")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String() + "/debug/buildinfo"
+}
+
+func adminGet(t *testing.T, ca *certstest.CA, url string, client *certstest.Pair, token string) (int, error) {
+	t.Helper()
+
+	tlsConfig := &tls.Config{RootCAs: ca.Pool()}
+	if client != nil {
+		tlsConfig.Certificates = []tls.Certificate{client.TLS(t)}
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func TestAdminServerClientCertificates(t *testing.T) {
+	ca := certstest.NewCA(t)
+	caFile := filepath.Join(t.TempDir(), "admin-ca.pem")
+	if err := os.WriteFile(caFile, ca.CertPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	trusted := ca.Client(t, "operator")
+	untrusted := certstest.NewCA(t).Client(t, "intruder")
+
+	tests := []struct {
+		name       string
+		token      string
+		client     *certstest.Pair
+		sendToken  string
+		wantStatus int // zero when the handshake must fail
+	}{
+		{name: "mTLS: trusted certificate", client: &trusted, wantStatus: http.StatusOK},
+		{name: "mTLS: no certificate"},
+		{name: "mTLS: certificate of another CA", client: &untrusted},
+		{name: "mTLS and token: both", token: testAdminToken, client: &trusted, sendToken: testAdminToken, wantStatus: http.StatusOK},
+		{name: "mTLS and token: certificate only", token: testAdminToken, client: &trusted, wantStatus: http.StatusUnauthorized},
+		{name: "mTLS and token: token only", token: testAdminToken, sendToken: testAdminToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := startAdminServer(t, ca, &config.Config{
+				AdminAddress:      "127.0.0.1:0",
+				AdminToken:        tt.token,
+				AdminClientCAFile: caFile,
+			})
+
+			status, err := adminGet(t, ca, url, tt.client, tt.sendToken)
+			if tt.wantStatus == 0 {
+				if err == nil {
+					t.Fatalf("request succeeded with status %d, want the handshake to fail", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAdminServerTLSWithoutClientCAs(t *testing.T) {
+	ca := certstest.NewCA(t)
+	url := startAdminServer(t, ca, &config.Config{AdminAddress: "127.0.0.1:0", AdminToken: testAdminToken})
+
+	if status, err := adminGet(t, ca, url, nil, testAdminToken); err != nil || status != http.StatusOK {
+		t.Errorf("with token = %d, %v; want %d", status, err, http.StatusOK)
+	}
+	if status, err := adminGet(t, ca, url, nil, ""); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("without token = %d, %v; want %d", status, err, http.StatusUnauthorized)
+	}
+}
+
+func TestWithClientCAsRejectsMissingFile(t *testing.T) {
+	if _, err := withClientCAs(&tls.Config{}, filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("withClientCAs accepted a missing CA file")
+	}
+}
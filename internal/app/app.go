@@ -1,31 +1,185 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/learies/gofermart/internal/config"
 	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/lifecycle"
 	"github.com/learies/gofermart/internal/routes"
+	"github.com/learies/gofermart/internal/tracing"
 )
 
 type App struct {
 	Router *routes.Router
 	Config *config.Config
+
+	lifecycle *lifecycle.Lifecycle
+	server    *http.Server
+	serveErr  chan error
+	hangup    chan os.Signal
+
+	// runtimeConfig is Config with the reloaded settings applied.
+	runtimeConfig atomic.Pointer[config.Config]
 }
 
 func NewApp(cfg *config.Config) (*App, error) {
+	lc := lifecycle.New()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		File:        cfg.TracingFile,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up tracing: %w", err)
+	}
+	// Added first so that it is stopped last, after every span has ended.
+	lc.Append(lifecycle.Hook{Name: "tracing", OnStop: shutdownTracing})
+
+	// SIGHUP terminates the process unless handled, so the handler is in
+	// place before the slow part of the start. A signal received meanwhile
+	// is picked up by watchConfig.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	lc.Append(lifecycle.Hook{Name: "SIGHUP handler", OnStop: func(context.Context) error {
+		signal.Stop(hangup)
+		return nil
+	}})
+
 	router := routes.NewRouter()
-	if err := router.Initialize(cfg); err != nil {
+	if err := router.Initialize(cfg, lc); err != nil {
+		stopOnError(lc)
 		return nil, err
 	}
 
-	return &App{
-		Router: router,
-		Config: cfg,
-	}, nil
+	a := &App{
+		Router:    router,
+		Config:    cfg,
+		lifecycle: lc,
+		server:    &http.Server{Addr: cfg.RunAddress, Handler: router.Mux},
+		serveErr:  make(chan error, 4),
+		hangup:    hangup,
+	}
+	a.runtimeConfig.Store(cfg)
+	lc.Go("config reloader", a.watchConfig)
+
+	var tlsConfig *tls.Config
+	if cfg.TLSEnabled() {
+		if tlsConfig, err = newTLSConfig(cfg, lc); err != nil {
+			stopOnError(lc)
+			return nil, err
+		}
+		a.server.TLSConfig = tlsConfig
+	}
+
+	// The admin listener starts before the API and stops after it, so that
+	// the drain can still be watched.
+	if cfg.AdminAddress != "" {
+		adminServer, err := a.newAdminServer(tlsConfig)
+		if err != nil {
+			stopOnError(lc)
+			return nil, err
+		}
+		lc.Append(lifecycle.Hook{
+			Name:    "admin server",
+			OnStart: a.serve(adminServer),
+			OnStop:  adminServer.Shutdown,
+		})
+	}
+
+	if cfg.RedirectAddress != "" {
+		redirect := &http.Server{Addr: cfg.RedirectAddress, Handler: httpsRedirect(cfg.RunAddress)}
+		lc.Append(lifecycle.Hook{
+			Name:    "https redirect server",
+			OnStart: a.serve(redirect),
+			OnStop:  redirect.Shutdown,
+		})
+	}
+
+	lc.Append(lifecycle.Hook{
+		Name:    "http server",
+		OnStart: a.serve(a.server),
+		OnStop:  a.server.Shutdown,
+	})
+
+	return a, nil
 }
 
+// stopOnError releases whatever was opened before NewApp failed.
+func stopOnError(lc *lifecycle.Lifecycle) {
+	if err := lc.Stop(context.Background()); err != nil {
+		logger.Log.Error("Failed to release resources", "error", err)
+	}
+}
+
+// serve binds the address of server before returning, so that a port already
+// in use fails the start instead of a background goroutine. Servers with a
+// TLS configuration serve HTTPS, and HTTP/2 to clients that offer it.
+func (a *App) serve(server *http.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			return err
+		}
+
+		logger.Log.Info("Starting server", "address", server.Addr, "tls", server.TLSConfig != nil)
+		go func() {
+			var err error
+			if server.TLSConfig != nil {
+				// The certificate comes from TLSConfig.GetCertificate.
+				err = server.ServeTLS(listener, "", "")
+			} else {
+				err = server.Serve(listener)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				a.serveErr <- err
+			}
+		}()
+		return nil
+	}
+}
+
+// Run starts the service and blocks until SIGINT or SIGTERM, or until the
+// server fails. It then stops accepting connections, drains in-flight
+// requests, stops the workers and closes the storage, all within the
+// configured shutdown timeout.
 func (a *App) Run() error {
-	logger.Log.Info("Starting server", "address", a.Config.RunAddress)
-	return http.ListenAndServe(a.Config.RunAddress, a.Router.Mux)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := a.lifecycle.Start(ctx); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logger.Log.Info("Shutting down", "timeout", a.Config.ShutdownTimeout.String())
+	case err := <-a.serveErr:
+		runErr = fmt.Errorf("server failed: %w", err)
+	}
+	// A second signal kills the process instead of waiting for the drain.
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+
+	if err := a.lifecycle.Stop(shutdownCtx); err != nil {
+		return errors.Join(runErr, fmt.Errorf("shutdown: %w", err))
+	}
+
+	if runErr == nil {
+		logger.Log.Info("Server stopped")
+	}
+	return runErr
 }
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/learies/gofermart/internal/config"
+	"github.com/learies/gofermart/internal/config/logger"
+)
+
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the configuration on SIGHUP and whenever the config
+// file is modified.
+func (a *App) watchConfig(ctx context.Context) {
+	path := a.Config.ConfigFile
+	var poll <-chan time.Time
+	if path != "" {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	modified := modTime(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.hangup:
+			a.reloadConfig("signal")
+		case <-poll:
+			if m := modTime(path); !m.Equal(modified) {
+				modified = m
+				a.reloadConfig("file")
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig applies the reloadable settings that changed. A configuration
+// that does not load or validate is rejected as a whole and the running one
+// is kept.
+func (a *App) reloadConfig(trigger string) {
+	next, err := config.Reload()
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		logger.Log.Error("Configuration reload rejected", "trigger", trigger, "error", err)
+		return
+	}
+
+	current := a.runtimeConfig.Load()
+	var applied, ignored []string
+	for _, change := range current.Diff(next) {
+		if !change.Reloadable {
+			ignored = append(ignored, change.String())
+			continue
+		}
+		applied = append(applied, change.String())
+		if change.Key == "log_level" {
+			// Only on change, so that a level set through the admin
+			// endpoint survives unrelated reloads.
+			logger.SetLevel(next.LogLevel)
+		}
+	}
+	if len(ignored) > 0 {
+		logger.Log.Warn("Configuration changes require a restart", "trigger", trigger, "changes", ignored)
+	}
+	if len(applied) == 0 {
+		logger.Log.Info("Configuration reloaded without changes to apply", "trigger", trigger)
+		return
+	}
+
+	merged := current.WithReloadable(next)
+	a.Router.ApplyConfig(merged)
+	a.runtimeConfig.Store(merged)
+
+	logger.Log.Info("Configuration reloaded", "trigger", trigger, "changes", applied)
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/learies/gofermart/internal/certs"
+	"github.com/learies/gofermart/internal/config"
+	"github.com/learies/gofermart/internal/lifecycle"
+)
+
+// newTLSConfig serves the configured certificate, picking up renewals
+// without a restart.
+func newTLSConfig(cfg *config.Config, lc *lifecycle.Lifecycle) (*tls.Config, error) {
+	minVersion, err := certs.ParseVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	lc.Go("certificate reloader", reloader.Run)
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// httpsRedirect sends plain HTTP requests to the same host and path on the
+// TLS listener at runAddress.
+func httpsRedirect(runAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(runAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/learies/gofermart/internal/certs/certstest"
+	"github.com/learies/gofermart/internal/config"
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/lifecycle"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.NewLogger(logger.Options{Level: "error", Format: "text", Output: "stderr"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name       string
+		runAddress string
+		target     string
+		host       string
+		want       string
+	}{
+		{
+			name:       "default port",
+			runAddress: ":443",
+			target:     "/api/user/orders?limit=10",
+			host:       "gophermart.test",
+			want:       "https://gophermart.test/api/user/orders?limit=10",
+		},
+		{
+			name:       "port of the request replaced",
+			runAddress: "0.0.0.0:443",
+			target:     "/",
+			host:       "gophermart.test:80",
+			want:       "https://gophermart.test/",
+		},
+		{
+			name:       "other port",
+			runAddress: "localhost:8443",
+			target:     "/api/user/balance",
+			host:       "gophermart.test:8080",
+			want:       "https://gophermart.test:8443/api/user/balance",
+		},
+		{
+			name:       "IPv6 host",
+			runAddress: ":8443",
+			target:     "/",
+			host:       "[::1]",
+			want:       "https://[::1]:8443/",
+		},
+		{
+			name:       "escaped path",
+			runAddress: ":443",
+			target:     "/a%20b/c",
+			host:       "gophermart.test",
+			want:       "https://gophermart.test/a%20b/c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, method := range []string{http.MethodGet, http.MethodPost} {
+				req := httptest.NewRequest(method, tt.target, nil)
+				req.Host = tt.host
+				rec := httptest.NewRecorder()
+				httpsRedirect(tt.runAddress).ServeHTTP(rec, req)
+
+				// 308 keeps the method and body of a POST.
+				if rec.Code != http.StatusPermanentRedirect {
+					t.Errorf("%s status = %d, want %d", method, rec.Code, http.StatusPermanentRedirect)
+				}
+				if got := rec.Header().Get("Location"); got != tt.want {
+					t.Errorf("%s Location = %q, want %q", method, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTLSConfigServesHTTP2(t *testing.T) {
+	ca := certstest.NewCA(t)
+	pair := ca.Server(t, 1)
+	dir := t.TempDir()
+	cfg := &config.Config{
+		TLSCertFile:   filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:    filepath.Join(dir, "key.pem"),
+		TLSMinVersion: "1.3",
+	}
+	if err := os.WriteFile(cfg.TLSCertFile, pair.CertPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.TLSKeyFile, pair.KeyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig, err := newTLSConfig(cfg, lifecycle.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: tlsConfig,
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: ca.Pool()},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("served %s over TLS %x, want HTTP/2 over TLS 1.3", resp.Proto, resp.TLS.Version)
+	}
+
+	old := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: ca.Pool(), MaxVersion: tls.VersionTLS12},
+	}}
+	if resp, err := old.Get("https://" + listener.Addr().String()); err == nil {
+		resp.Body.Close()
+		t.Error("a TLS 1.2 client was served despite tls_min_version 1.3")
+	}
+}
@@ -0,0 +1,52 @@
+// Package buildinfo describes the running binary. Version, Commit and Date
+// are set at build time:
+//
+//	go build -ldflags "-X github.com/learies/gofermart/internal/buildinfo.Version=v1.2.0 \
+//		-X github.com/learies/gofermart/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X github.com/learies/gofermart/internal/buildinfo.Date=$(date -u +%FT%TZ)"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module,omitempty"`
+}
+
+// Get returns the build information. Without -ldflags, the commit and date
+// recorded by the Go toolchain from version control are used, if any.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = build.Main.Path
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.Date == "":
+			info.Date = setting.Value
+		}
+	}
+	return info
+}
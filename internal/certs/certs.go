@@ -0,0 +1,121 @@
+// Package certs serves TLS certificates that are reloaded when their files
+// change on disk, e.g. after a renewal.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+)
+
+const pollInterval = 5 * time.Second
+
+// Reloader holds a certificate and its key, and loads them again once either
+// file is modified.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	cert     atomic.Pointer[tls.Certificate]
+	modified time.Time
+}
+
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.modified = r.modTime()
+	return nil
+}
+
+// modTime returns the latest modification of the two files.
+func (r *Reloader) modTime() time.Time {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Run watches the files until ctx is cancelled. A pair that fails to load,
+// e.g. because only one of the files has been replaced yet, is tried again
+// once a file changes again; the previous certificate stays in use meanwhile.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var failed time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			failed = r.reloadIfModified(failed)
+		}
+	}
+}
+
+// reloadIfModified loads the pair again if a file changed since the last
+// load and since failed, the modification time of the last pair that did not
+// load. It returns the modification time to remember as failed.
+func (r *Reloader) reloadIfModified(failed time.Time) time.Time {
+	modified := r.modTime()
+	if modified.Equal(r.modified) || modified.Equal(failed) {
+		return failed
+	}
+	if err := r.load(); err != nil {
+		logger.Log.Error("Failed to reload TLS certificate", "cert", r.certFile, "error", err)
+		return modified
+	}
+	logger.Log.Info("Reloaded TLS certificate", "cert", r.certFile)
+	return failed
+}
+
+// ParseVersion accepts "1.2" and "1.3".
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q", version)
+}
+
+// LoadCertPool reads PEM certificates, e.g. the CAs that client
+// certificates must chain to.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no PEM certificates found in " + file)
+	}
+	return pool, nil
+}
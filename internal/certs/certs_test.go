@@ -0,0 +1,122 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/learies/gofermart/internal/certs/certstest"
+	"github.com/learies/gofermart/internal/config/logger"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.NewLogger(logger.Options{Level: "error", Format: "text", Output: "stderr"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// writeAt writes data to path and dates it at, since the file system may not
+// tell writes within the same tick apart.
+func writeAt(t *testing.T, path string, data []byte, at time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedSerial(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	ca := certstest.NewCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	first := ca.Server(t, 1)
+	writeAt(t, certFile, first.CertPEM, start)
+	writeAt(t, keyFile, first.KeyPEM, start)
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, r); serial != 1 {
+		t.Fatalf("serving serial %d, want 1", serial)
+	}
+
+	var failed time.Time
+	if failed = r.reloadIfModified(failed); servedSerial(t, r) != 1 || !failed.IsZero() {
+		t.Fatal("unchanged files were reloaded")
+	}
+
+	// A renewal replaces the certificate first: the mismatched pair is
+	// rejected and the old certificate stays in use.
+	second := ca.Server(t, 2)
+	writeAt(t, certFile, second.CertPEM, start.Add(time.Minute))
+	if failed = r.reloadIfModified(failed); servedSerial(t, r) != 1 {
+		t.Fatal("a mismatched pair replaced the certificate")
+	}
+	if !failed.Equal(start.Add(time.Minute)) {
+		t.Errorf("failed = %v, want the time of the rejected pair", failed)
+	}
+
+	writeAt(t, keyFile, second.KeyPEM, start.Add(2*time.Minute))
+	if failed = r.reloadIfModified(failed); servedSerial(t, r) != 2 {
+		t.Fatal("the renewed pair was not loaded")
+	}
+
+	if _, err := NewReloader(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("NewReloader accepted a missing key")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for version, want := range map[string]uint16{"1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13} {
+		if got, err := ParseVersion(version); err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %x, %v; want %x", version, got, err, want)
+		}
+	}
+	for _, version := range []string{"", "1.1", "TLS1.3"} {
+		if _, err := ParseVersion(version); err == nil {
+			t.Errorf("ParseVersion(%q) succeeded", version)
+		}
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, certstest.NewCA(t).CertPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertPool(caFile); err != nil {
+		t.Errorf("LoadCertPool: %v", err)
+	}
+
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{notPEM, filepath.Join(dir, "missing.pem")} {
+		if _, err := LoadCertPool(file); err == nil {
+			t.Errorf("LoadCertPool(%s) succeeded", filepath.Base(file))
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets the variables for the rest of the test, so that settings
+// of the machine running it do not leak in.
+func clearEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadArgs(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("gophermart", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return load(fs, args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE", "RUN_ADDRESS", "DB_TIMEOUT", "LOG_LEVEL", "ACCRUAL_WORKERS", "LOG_REDACT_FIELDS")
+	file := writeFile(t, "gophermart.yaml", `
+run_address: file:1
+db_timeout: 7s
+log_level: warn
+accrual_workers: 3
+log_redact_fields: [iban]
+`)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want func(cfg *Config) bool
+	}{
+		{
+			name: "defaults",
+			want: func(cfg *Config) bool {
+				return cfg.RunAddress == defaultAddress && cfg.DBTimeout == defaultDBTimeout && cfg.LogLevel == defaultLogLevel
+			},
+		},
+		{
+			name: "file over defaults",
+			args: []string{"-config", file},
+			want: func(cfg *Config) bool {
+				return cfg.ConfigFile == file && cfg.RunAddress == "file:1" && cfg.DBTimeout == 7*time.Second &&
+					cfg.AccrualWorkers == 3 && strings.Join(cfg.LogRedactFields, ",") == "iban" &&
+					cfg.PasswordMinLength == defaultPasswordMinLength
+			},
+		},
+		{
+			name: "file named by the environment",
+			env:  map[string]string{"CONFIG_FILE": file},
+			want: func(cfg *Config) bool { return cfg.ConfigFile == file && cfg.RunAddress == "file:1" },
+		},
+		{
+			name: "environment over file",
+			env:  map[string]string{"CONFIG_FILE": file, "RUN_ADDRESS": "env:2", "LOG_REDACT_FIELDS": "iban, card_number"},
+			want: func(cfg *Config) bool {
+				return cfg.RunAddress == "env:2" && cfg.DBTimeout == 7*time.Second &&
+					strings.Join(cfg.LogRedactFields, ",") == "iban,card_number"
+			},
+		},
+		{
+			name: "flags over environment and file",
+			env:  map[string]string{"RUN_ADDRESS": "env:2", "DB_TIMEOUT": "9s"},
+			args: []string{"-config", file, "-a", "flag:3", "-log-level", "debug"},
+			want: func(cfg *Config) bool {
+				return cfg.RunAddress == "flag:3" && cfg.DBTimeout == 9*time.Second && cfg.LogLevel == "debug" && cfg.AccrualWorkers == 3
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := loadArgs(t, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want(cfg) {
+				t.Errorf("config = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE", "ACCRUAL_WORKERS", "DB_TIMEOUT", "MIGRATE_ON_START")
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{
+			name: "every malformed variable",
+			env:  map[string]string{"ACCRUAL_WORKERS": "many", "DB_TIMEOUT": "5", "MIGRATE_ON_START": "maybe"},
+			want: []string{`ACCRUAL_WORKERS: invalid value "many"`, `DB_TIMEOUT: invalid value "5"`, `MIGRATE_ON_START: invalid value "maybe"`},
+		},
+		{
+			name: "unknown file key",
+			args: []string{"-config", writeFile(t, "typo.yaml", "run_adress: localhost:1\n")},
+			want: []string{"run_adress"},
+		},
+		{
+			name: "missing file",
+			args: []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			want: []string{"read config file"},
+		},
+		{
+			name: "malformed flag",
+			args: []string{"-db-timeout", "soon"},
+			want: []string{"db-timeout"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := loadArgs(t, tt.args...)
+			if err == nil {
+				t.Fatal("load succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func validConfig() *Config {
+	cfg := defaultConfig()
+	cfg.JWTSecret = strings.Repeat("j", minJWTSecretLength)
+	cfg.TOTPEncryptionKey = strings.Repeat("t", minTOTPEncryptionKeyLength)
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   []string
+	}{
+		{name: "valid", modify: func(cfg *Config) {}},
+		{
+			name: "missing secrets",
+			modify: func(cfg *Config) {
+				cfg.JWTSecret, cfg.TOTPEncryptionKey = "", ""
+			},
+			want: []string{"jwt_secret: is required", "totp_encryption_key: is required"},
+		},
+		{
+			name: "every problem at once",
+			modify: func(cfg *Config) {
+				cfg.RunAddress = "localhost"
+				cfg.DatabaseURI = "mysql://db/gophermart"
+				cfg.AccrualWorkers = 0
+				cfg.LoginLockoutMax = time.Second
+				cfg.BcryptCost = 3
+				cfg.LogLevel = "verbose"
+				cfg.JWTSecret = "short"
+			},
+			want: []string{
+				"run_address:", "database_uri:", "accrual_workers:", "login_lockout_max:",
+				"bcrypt_cost:", "log_level:", "jwt_secret: must be at least 32 bytes",
+			},
+		},
+		{
+			name: "inconsistent listeners",
+			modify: func(cfg *Config) {
+				cfg.RedirectAddress = cfg.RunAddress
+				cfg.AdminAddress = "localhost:9090"
+			},
+			want: []string{
+				"http_redirect_address: requires tls_cert_file", "http_redirect_address: must differ",
+				"admin_address: requires admin_token or admin_client_ca_file",
+			},
+		},
+		{
+			name:   "TLS key without certificate",
+			modify: func(cfg *Config) { cfg.TLSKeyFile = "key.pem" },
+			want:   []string{"tls_key_file: tls_cert_file and tls_key_file must be set together"},
+		},
+		{
+			name:   "memory storage ignores the database URI",
+			modify: func(cfg *Config) { cfg.StorageBackend, cfg.DatabaseURI = "memory", "" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not mention %q:\n%v", want, err)
+				}
+			}
+			if lines := strings.Count(err.Error(), "\n") + 1; lines != len(tt.want) {
+				t.Errorf("got %d problems, want %d:\n%v", lines, len(tt.want), err)
+			}
+		})
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	cfg := validConfig()
+	cfg.DatabaseURI = "postgres://gophermart:db-password@db:5432/gophermart?sslmode=disable"
+	cfg.DatabaseReplicaURI = "postgres://replica:5432/gophermart?password=replica-password"
+	cfg.AdminToken = "admin-token-0123456789"
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{cfg.JWTSecret, cfg.TOTPEncryptionKey, cfg.AdminToken, "db-password", "replica-password"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("printed configuration contains %q:\n%s", secret, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "run_address: localhost:8080") {
+		t.Errorf("printed configuration lacks run_address:\n%s", out.String())
+	}
+
+	// The printed form is a valid configuration file.
+	var reread Config
+	if err := reread.loadFile(writeFile(t, "printed.yaml", out.String())); err != nil {
+		t.Fatalf("printed configuration cannot be read back: %v", err)
+	}
+	if reread.DBTimeout != cfg.DBTimeout || reread.JWTSecret != maskedSecret {
+		t.Errorf("read back db_timeout %v and jwt_secret %q", reread.DBTimeout, reread.JWTSecret)
+	}
+}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fieldsKey struct{}
+
+// fields are the attributes of a request. They are shared by every context
+// derived from the one NewContext returned, so that an attribute learned deep
+// in the chain, such as the user ID, also reaches the access log written by
+// an outer middleware.
+type fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// NewContext returns a context whose log records carry attrs, and whatever
+// AddAttrs adds later.
+func NewContext(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{attrs: attrs})
+}
+
+// AddAttrs adds attrs to the records logged with ctx. It does nothing if ctx
+// does not descend from NewContext.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attrs = append(f.attrs, attrs...)
+}
+
+// contextHandler adds the request attributes and the trace and span IDs of
+// the context to every record logged with one of the *Context methods.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		// An attribute given explicitly, e.g. the user_id of a security
+		// event, takes precedence over the request one.
+		logged := make(map[string]bool, record.NumAttrs())
+		record.Attrs(func(attr slog.Attr) bool {
+			logged[attr.Key] = true
+			return true
+		})
+
+		f.mu.Lock()
+		for _, attr := range f.attrs {
+			if !logged[attr.Key] {
+				record.AddAttrs(attr)
+			}
+		}
+		f.mu.Unlock()
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
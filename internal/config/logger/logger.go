@@ -1,33 +1,94 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
+)
+
+// Formats.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
 )
 
 var Log *slog.Logger
 
-func NewLogger(level string) error {
-	var logLevel slog.Level
+// level is shared by every handler, so that SetLevel takes effect at once.
+var level slog.LevelVar
 
-	switch level {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "info":
-		logLevel = slog.LevelInfo
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
+type Options struct {
+	Level  string
+	Format string
+	// Output is stdout, stderr or the path of a file that is rotated once it
+	// grows past MaxSizeMB, keeping MaxBackups older files.
+	Output     string
+	MaxSizeMB  int
+	MaxBackups int
+	// RedactFields are masked in addition to the built-in sensitive fields.
+	RedactFields []string
+}
+
+func NewLogger(opts Options) error {
+	if err := SetLevel(opts.Level); err != nil {
+		return err
+	}
+
+	var out io.Writer
+	switch opts.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
 	default:
-		logLevel = slog.LevelInfo
+		file, err := newRotatingFile(opts.Output, int64(opts.MaxSizeMB)<<20, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		out = file
 	}
 
-	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
-	})
+	handlerOpts := &slog.HandlerOptions{
+		Level:       &level,
+		ReplaceAttr: newRedactor(opts.RedactFields).replaceAttr,
+	}
 
-	Log = slog.New(handler)
+	var handler slog.Handler
+	switch opts.Format {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	case FormatText:
+		handler = slog.NewTextHandler(out, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	Log = slog.New(contextHandler{handler})
 
 	return nil
 }
+
+// SetLevel changes the minimum level of logged records: debug, info, warn or
+// error.
+func SetLevel(name string) error {
+	switch strings.ToLower(name) {
+	case "debug":
+		level.Set(slog.LevelDebug)
+	case "", "info":
+		level.Set(slog.LevelInfo)
+	case "warn":
+		level.Set(slog.LevelWarn)
+	case "error":
+		level.Set(slog.LevelError)
+	default:
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	return nil
+}
+
+// Level returns the name of the current minimum level.
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields are always masked. A key matches when it equals one of them
+// or ends with "_" and one of them, e.g. new_password or access_token.
+var sensitiveFields = []string{
+	"password", "passwd", "secret", "token", "cookie", "set_cookie",
+	"authorization", "api_key", "apikey", "recovery_codes", "totp_code",
+}
+
+type redactor struct {
+	fields []string
+}
+
+func newRedactor(extra []string) *redactor {
+	r := &redactor{fields: append([]string(nil), sensitiveFields...)}
+	for _, field := range extra {
+		if field = normalizeKey(field); field != "" {
+			r.fields = append(r.fields, field)
+		}
+	}
+	return r
+}
+
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+}
+
+func (r *redactor) sensitive(key string) bool {
+	key = normalizeKey(key)
+	for _, field := range r.fields {
+		if key == field || strings.HasSuffix(key, "_"+field) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceAttr masks sensitive attributes. Structs, maps and slices are
+// inspected through their JSON form, so that e.g. the password of a logged
+// models.User is masked too.
+func (r *redactor) replaceAttr(_ []string, attr slog.Attr) slog.Attr {
+	if r.sensitive(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+	if attr.Value.Kind() != slog.KindAny {
+		return attr
+	}
+
+	value := attr.Value.Any()
+	switch value.(type) {
+	case error, time.Time:
+		return attr
+	}
+	if !composite(value) {
+		return attr
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return attr
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return attr
+	}
+	return slog.Any(attr.Key, r.redact(decoded))
+}
+
+func composite(value any) bool {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+func (r *redactor) redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if r.sensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = r.redact(item)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = r.redact(item)
+		}
+	}
+	return value
+}
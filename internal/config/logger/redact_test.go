@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+// logRecord logs one message with args through a JSON handler that redacts
+// the extra fields, and returns the decoded record.
+func logRecord(t *testing.T, extra []string, args ...any) map[string]any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: newRedactor(extra).replaceAttr}))
+	log.Info("message", args...)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("%s: %v", buf.Bytes(), err)
+	}
+	return record
+}
+
+func TestRedact(t *testing.T) {
+	type request struct {
+		Users   []models.User `json:"users"`
+		Creator *models.User  `json:"creator"`
+	}
+	user := models.User{ID: 1, Username: "alice", Password: "hunter2"}
+
+	tests := []struct {
+		name  string
+		extra []string
+		args  []any
+		want  string
+	}{
+		{name: "exact field", args: []any{"password", "hunter2"}, want: `{"password":"[REDACTED]"}`},
+		{name: "field in another case", args: []any{"Password", "hunter2"}, want: `{"Password":"[REDACTED]"}`},
+		{name: "suffix", args: []any{"new_password", "hunter2"}, want: `{"new_password":"[REDACTED]"}`},
+		{name: "header name", args: []any{"X-API-Key", "gm_abc"}, want: `{"X-API-Key":"[REDACTED]"}`},
+		{name: "prefix is not a match", args: []any{"token_count", 3}, want: `{"token_count":3}`},
+		{name: "suffix without separator is not a match", args: []any{"bypassword", "x"}, want: `{"bypassword":"x"}`},
+		{name: "ordinary field", args: []any{"login", "alice"}, want: `{"login":"alice"}`},
+		{name: "struct", args: []any{"user", user}, want: `{"user":{"id":1,"login":"alice","password":"[REDACTED]"}}`},
+		{name: "pointer to struct", args: []any{"user", &user}, want: `{"user":{"id":1,"login":"alice","password":"[REDACTED]"}}`},
+		{
+			name: "struct in a struct and a slice",
+			args: []any{"request", request{Users: []models.User{user}, Creator: &user}},
+			want: `{"request":{"creator":{"id":1,"login":"alice","password":"[REDACTED]"},"users":[{"id":1,"login":"alice","password":"[REDACTED]"}]}}`,
+		},
+		{
+			name: "map",
+			args: []any{"headers", map[string]string{"Authorization": "Bearer x", "Accept": "*/*"}},
+			want: `{"headers":{"Accept":"*/*","Authorization":"[REDACTED]"}}`,
+		},
+		{name: "group", args: []any{slog.Group("request", "cookie", "token=x", "path", "/")}, want: `{"request":{"cookie":"[REDACTED]","path":"/"}}`},
+		{name: "error", args: []any{"error", errors.New("password mismatch")}, want: `{"error":"password mismatch"}`},
+		{name: "bytes", args: []any{"body", []byte("raw")}, want: `{"body":"cmF3"}`},
+		{name: "extra field", extra: []string{"iban"}, args: []any{"iban", "DE89"}, want: `{"iban":"[REDACTED]"}`},
+		{name: "extra field suffix", extra: []string{"iban"}, args: []any{"payout_iban", "DE89"}, want: `{"payout_iban":"[REDACTED]"}`},
+		{name: "extra field normalised", extra: []string{" Card-Number "}, args: []any{"card_number", "4111"}, want: `{"card_number":"[REDACTED]"}`},
+		{name: "empty extra field ignored", extra: []string{""}, args: []any{"login", "alice"}, want: `{"login":"alice"}`},
+		{
+			name:  "extra field in a struct",
+			extra: []string{"login"},
+			args:  []any{"user", user},
+			want:  `{"user":{"id":1,"login":"[REDACTED]","password":"[REDACTED]"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := logRecord(t, tt.extra, tt.args...)
+			for _, key := range []string{slog.TimeKey, slog.LevelKey, slog.MessageKey} {
+				delete(record, key)
+			}
+			got, err := json.Marshal(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("logged %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
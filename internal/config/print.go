@@ -0,0 +1,54 @@
+package config
+
+import (
+	"io"
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+const maskedSecret = "********"
+
+// Masked returns a copy of the configuration that is safe to show: secrets
+// are replaced and database URIs lose their passwords.
+func (cfg *Config) Masked() *Config {
+	masked := *cfg
+	masked.LogRedactFields = append([]string(nil), cfg.LogRedactFields...)
+
+	for _, secret := range []*string{&masked.JWTSecret, &masked.TOTPEncryptionKey, &masked.OIDCClientSecret, &masked.AdminToken} {
+		if *secret != "" {
+			*secret = maskedSecret
+		}
+	}
+	masked.DatabaseURI = maskURI(masked.DatabaseURI)
+	masked.DatabaseReplicaURI = maskURI(masked.DatabaseReplicaURI)
+	return &masked
+}
+
+// maskURI hides the password of a URI, whether in its user info or in a
+// password query parameter.
+func maskURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		if uri == "" {
+			return ""
+		}
+		return maskedSecret
+	}
+	if query := u.Query(); query.Has("password") {
+		query.Set("password", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// Print writes the masked configuration as YAML, in the format read by
+// -config.
+func (cfg *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.Masked()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
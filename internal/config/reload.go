@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change is a setting that differs between two configurations.
+type Change struct {
+	Key        string
+	Old, New   string
+	Reloadable bool
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Key, c.Old, c.New)
+}
+
+// Diff lists the settings that differ from cfg in next, with secrets masked.
+func (cfg *Config) Diff(next *Config) []Change {
+	// Compared unmasked, so that a changed secret is noticed, but shown masked.
+	rawOld, rawNew := reflect.ValueOf(*cfg), reflect.ValueOf(*next)
+	old, updated := reflect.ValueOf(*cfg.Masked()), reflect.ValueOf(*next.Masked())
+	fields := old.Type()
+
+	var changes []Change
+	for i := 0; i < fields.NumField(); i++ {
+		key := strings.Split(fields.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		if reflect.DeepEqual(rawOld.Field(i).Interface(), rawNew.Field(i).Interface()) {
+			continue
+		}
+		changes = append(changes, Change{
+			Key:        key,
+			Old:        formatSetting(old.Field(i)),
+			New:        formatSetting(updated.Field(i)),
+			Reloadable: fields.Field(i).Tag.Get("reload") == "true",
+		})
+	}
+	return changes
+}
+
+func formatSetting(v reflect.Value) string {
+	if list, ok := v.Interface().([]string); ok {
+		return "[" + strings.Join(list, ",") + "]"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// WithReloadable returns a copy of cfg that takes the reloadable settings
+// from next and keeps the others.
+func (cfg *Config) WithReloadable(next *Config) *Config {
+	merged := *cfg
+	target, source := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next).Elem()
+	fields := target.Type()
+	for i := 0; i < fields.NumField(); i++ {
+		if fields.Field(i).Tag.Get("reload") == "true" {
+			target.Field(i).Set(source.Field(i))
+		}
+	}
+	return &merged
+}
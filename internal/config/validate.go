@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	minJWTSecretLength         = 32
+	minTOTPEncryptionKeyLength = 32
+	minAdminTokenLength        = 16
+)
+
+// validator collects every problem, so that a broken configuration is
+// reported in one go rather than one restart at a time.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(ok bool, key, format string, args ...any) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v *validator) address(key, value string) {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		v.check(false, key, "%q is not a host:port address", value)
+		return
+	}
+	n, err := strconv.Atoi(port)
+	v.check(err == nil && n > 0 && n <= 65535, key, "port %q is not between 1 and 65535", port)
+	v.check(!strings.ContainsAny(host, " /"), key, "host %q is malformed", host)
+}
+
+func (v *validator) url(key, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil {
+		v.check(false, key, "%v", err)
+		return
+	}
+	known := false
+	for _, scheme := range schemes {
+		known = known || u.Scheme == scheme
+	}
+	if !known {
+		v.check(false, key, "must be a %s URL, got %q", strings.Join(schemes, " or "), value)
+		return
+	}
+	v.check(u.Host != "" || u.Scheme == "sqlite", key, "host is missing")
+}
+
+func (v *validator) file(key, path string) {
+	_, err := os.Stat(path)
+	v.check(err == nil, key, "%v", err)
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, key, "must be one of %q, got %q", allowed, value)
+}
+
+// Validate reports every setting that is malformed, out of range or
+// inconsistent with another one.
+func (cfg *Config) Validate() error {
+	v := &validator{}
+
+	v.address("run_address", cfg.RunAddress)
+
+	v.check((cfg.TLSCertFile == "") == (cfg.TLSKeyFile == ""), "tls_key_file", "tls_cert_file and tls_key_file must be set together")
+	if cfg.TLSEnabled() {
+		v.file("tls_cert_file", cfg.TLSCertFile)
+		v.file("tls_key_file", cfg.TLSKeyFile)
+	}
+	v.oneOf("tls_min_version", cfg.TLSMinVersion, "1.2", "1.3")
+	if cfg.RedirectAddress != "" {
+		v.address("http_redirect_address", cfg.RedirectAddress)
+		v.check(cfg.TLSEnabled(), "http_redirect_address", "requires tls_cert_file")
+		v.check(cfg.RedirectAddress != cfg.RunAddress, "http_redirect_address", "must differ from the other listeners")
+	}
+	if cfg.AdminAddress != "" {
+		v.address("admin_address", cfg.AdminAddress)
+		v.check(cfg.AdminAddress != cfg.RunAddress && cfg.AdminAddress != cfg.RedirectAddress,
+			"admin_address", "must differ from the other listeners")
+		v.check(cfg.AdminToken != "" || cfg.AdminClientCAFile != "", "admin_address", "requires admin_token or admin_client_ca_file")
+	}
+	v.check(cfg.AdminToken == "" || len(cfg.AdminToken) >= minAdminTokenLength, "admin_token", "must be at least %d bytes", minAdminTokenLength)
+	if cfg.AdminClientCAFile != "" {
+		v.file("admin_client_ca_file", cfg.AdminClientCAFile)
+		v.check(cfg.TLSEnabled(), "admin_client_ca_file", "requires tls_cert_file")
+		v.check(cfg.AdminAddress != "", "admin_client_ca_file", "requires admin_address")
+	}
+
+	v.oneOf("storage", cfg.StorageBackend, "", "memory")
+	if cfg.StorageBackend == "" {
+		v.url("database_uri", cfg.DatabaseURI, "postgres", "postgresql", "sqlite")
+	}
+	if cfg.DatabaseReplicaURI != "" {
+		v.url("database_replica_uri", cfg.DatabaseReplicaURI, "postgres", "postgresql")
+	}
+	v.url("accrual_system_address", cfg.AccrualSystemAddress, "http", "https")
+	v.check(cfg.AccrualPollInterval >= 0, "accrual_poll_interval", "must not be negative")
+	v.check(cfg.AccrualWorkers > 0, "accrual_workers", "must be positive")
+
+	v.check(cfg.DBTimeout > 0, "db_timeout", "must be positive")
+	v.check(cfg.ShutdownTimeout > 0, "shutdown_timeout", "must be positive")
+	v.check(cfg.DBStartupTimeout > 0, "db_startup_timeout", "must be positive")
+	v.check(cfg.DBMaxConns > 0, "db_max_conns", "must be positive")
+	v.check(cfg.DBMinConns >= 0 && cfg.DBMinConns <= cfg.DBMaxConns, "db_min_conns", "must be between 0 and db_max_conns")
+	v.check(cfg.DBMaxConnLifetime >= 0, "db_max_conn_lifetime", "must not be negative")
+	v.check(cfg.DBMaxConnIdleTime >= 0, "db_max_conn_idle_time", "must not be negative")
+	v.check(cfg.DBHealthCheckPeriod >= 0, "db_health_check_period", "must not be negative")
+
+	v.check(cfg.LoginMaxAttempts > 0, "login_max_attempts", "must be positive")
+	v.check(cfg.LoginMaxAttemptsPerIP > 0, "login_max_attempts_per_ip", "must be positive")
+	v.check(cfg.LoginLockoutBase > 0, "login_lockout_base", "must be positive")
+	v.check(cfg.LoginLockoutMax >= cfg.LoginLockoutBase, "login_lockout_max", "must not be shorter than login_lockout_base")
+	v.check(cfg.LoginAttemptWindow > 0, "login_attempt_window", "must be positive")
+
+	v.check(cfg.PasswordMinLength > 0, "password_min_length", "must be positive")
+	v.oneOf("password_hash_algorithm", cfg.PasswordHashAlgorithm, "bcrypt", "argon2id")
+	v.check(cfg.BcryptCost >= 4 && cfg.BcryptCost <= 31, "bcrypt_cost", "must be between 4 and 31")
+	v.check(cfg.Argon2Time > 0, "argon2_time", "must be positive")
+	v.check(cfg.Argon2Threads > 0 && cfg.Argon2Threads <= 255, "argon2_threads", "must be between 1 and 255")
+	v.check(cfg.Argon2Memory >= 8*cfg.Argon2Threads, "argon2_memory", "must be at least 8 KiB per thread")
+	v.check(cfg.TOTPWithdrawalThreshold >= 0, "totp_withdrawal_threshold", "must not be negative")
+	v.check(cfg.TOTPEncryptionKey != "", "totp_encryption_key", "is required, set TOTP_ENCRYPTION_KEY or -totp-encryption-key")
+	v.check(cfg.TOTPEncryptionKey == "" || len(cfg.TOTPEncryptionKey) >= minTOTPEncryptionKeyLength, "totp_encryption_key", "must be at least %d bytes", minTOTPEncryptionKeyLength)
+
+	v.check(cfg.JWTSecret != "", "jwt_secret", "is required, set JWT_SECRET or -jwt-secret")
+	v.check(cfg.JWTSecret == "" || len(cfg.JWTSecret) >= minJWTSecretLength, "jwt_secret", "must be at least %d bytes", minJWTSecretLength)
+
+	if cfg.OIDCIssuerURL != "" {
+		v.url("oidc_issuer_url", cfg.OIDCIssuerURL, "https", "http")
+		v.url("oidc_redirect_url", cfg.OIDCRedirectURL, "https", "http")
+		v.check(cfg.OIDCClientID != "", "oidc_client_id", "is required with oidc_issuer_url")
+		v.check(cfg.OIDCClientSecret != "", "oidc_client_secret", "is required with oidc_issuer_url")
+	}
+
+	v.check(cfg.AuditRetention >= 0, "audit_retention", "must not be negative")
+
+	v.oneOf("tracing_exporter", cfg.TracingExporter, "", "stdout", "file", "otlp")
+	v.check(cfg.TracingExporter != "file" || cfg.TracingFile != "", "tracing_file", "is required with the file exporter")
+	v.check(cfg.TracingSampleRatio >= 0 && cfg.TracingSampleRatio <= 1, "tracing_sample_ratio", "must be between 0 and 1")
+
+	v.oneOf("log_level", strings.ToLower(cfg.LogLevel), "debug", "info", "warn", "error")
+	v.oneOf("log_format", cfg.LogFormat, "json", "text")
+	v.check(cfg.LogOutput != "", "log_output", "must not be empty")
+	v.check(cfg.LogMaxSizeMB >= 0, "log_max_size_mb", "must not be negative")
+	v.check(cfg.LogMaxBackups >= 0, "log_max_backups", "must not be negative")
+
+	return errors.Join(v.errs...)
+}
@@ -3,3 +3,10 @@ package constants
 type contextKey string
 
 const UserIDKey contextKey = "userID"
+
+// APIKeyScopesKey holds the scopes of the API key a request was authenticated
+// with. It is absent for cookie sessions, which are not restricted.
+const APIKeyScopesKey contextKey = "apiKeyScopes"
+
+// RequestIDKey holds the ID the request is logged and audited under.
+const RequestIDKey contextKey = "requestID"
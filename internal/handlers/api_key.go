@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+func (h *Handler) CreateAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var request models.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.Name == "" || len(request.Scopes) == 0 {
+			http.Error(w, "Name and at least one scope are required", http.StatusBadRequest)
+			return
+		}
+		for _, scope := range request.Scopes {
+			if !slices.Contains(models.APIKeyScopes, scope) {
+				http.Error(w, "Unknown scope "+scope, http.StatusBadRequest)
+				return
+			}
+		}
+		if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+			http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		key, prefix, err := services.GenerateAPIKey()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		apiKey := models.APIKey{
+			UserID:    UserID,
+			Name:      request.Name,
+			Prefix:    prefix,
+			Scopes:    request.Scopes,
+			ExpiresAt: request.ExpiresAt,
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		if err := h.apiKeys.CreateAPIKey(ctx, &apiKey, services.HashAPIKey(key)); err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to create API key", "error", err)
+			storageError(w, err)
+			return
+		}
+
+		logger.Log.InfoContext(r.Context(), "Security event", "event", "api_key_created", "user_id", UserID, "key_id", apiKey.ID, "scopes", apiKey.Scopes)
+		h.audit(r, models.AuditAPIKeyCreated, UserID, map[string]string{
+			"key_id": strconv.FormatInt(apiKey.ID, 10),
+			"scopes": strings.Join(apiKey.Scopes, ","),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.CreatedAPIKey{APIKey: apiKey, Key: key})
+	}
+}
+
+func (h *Handler) ListAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		keys, err := h.apiKeys.ListAPIKeys(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+func (h *Handler) RevokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		keyID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid key id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		if err := h.apiKeys.RevokeAPIKey(ctx, UserID, keyID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, "Key not found", http.StatusNotFound)
+				return
+			}
+			storageError(w, err)
+			return
+		}
+
+		logger.Log.InfoContext(r.Context(), "Security event", "event", "api_key_revoked", "user_id", UserID, "key_id", keyID)
+		h.audit(r, models.AuditAPIKeyRevoked, UserID, map[string]string{"key_id": strconv.FormatInt(keyID, 10)})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// audit records a security-relevant event together with where the request
+// came from.
+func (h *Handler) audit(r *http.Request, eventType string, userID int64, details map[string]string) {
+	requestID, _ := r.Context().Value(constants.RequestIDKey).(string)
+	h.auditor.Emit(r.Context(), models.AuditEvent{
+		Type:      eventType,
+		UserID:    userID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: requestID,
+		Details:   details,
+	})
+}
+
+// parseAuditQuery reads the filters of GET /api/admin/audit: user_id, type,
+// from and to (RFC 3339), before (an event ID, for paging) and limit.
+func parseAuditQuery(r *http.Request) (models.AuditQuery, error) {
+	values := r.URL.Query()
+	query := models.AuditQuery{Type: values.Get("type"), Limit: defaultAuditPageSize}
+
+	for name, target := range map[string]*int64{"user_id": &query.UserID, "before": &query.BeforeID} {
+		if value := values.Get(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				return query, fmt.Errorf("%s must be a positive integer", name)
+			}
+			*target = n
+		}
+	}
+
+	for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := values.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*target = t
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxAuditPageSize)
+		}
+		query.Limit = n
+	}
+
+	return query, nil
+}
+
+func (h *Handler) ListAuditEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		query, err := parseAuditQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		events, err := h.auditEvents.ListAuditEvents(ctx, query)
+		if err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to list audit events", "error", err)
+			storageError(w, err)
+			return
+		}
+
+		h.audit(r, models.AuditAdminAuditViewed, UserID, map[string]string{"query": r.URL.RawQuery})
+
+		if len(events) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(events)
+	}
+}
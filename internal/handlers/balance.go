@@ -15,9 +15,12 @@ func (h *Handler) GetUserBalance() http.HandlerFunc {
 			return
 		}
 
-		userBalance, err := h.balance.GetUserBalance(UserID)
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		userBalance, err := h.balance.GetUserBalance(ctx, UserID)
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			storageError(w, err)
 			return
 		}
 
@@ -36,9 +39,12 @@ func (h *Handler) GetUserWithdrawals() http.HandlerFunc {
 			return
 		}
 
-		userWithdrawals, err := h.balance.GetWithdrawalsByUserID(UserID)
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		userWithdrawals, err := h.balance.GetWithdrawalsByUserID(ctx, UserID)
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			storageError(w, err)
 			return
 		}
 
@@ -1,28 +1,155 @@
 package handlers
 
 import (
-	"github.com/jackc/pgx/v5/pgxpool"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync/atomic"
+	"time"
 
+	"github.com/learies/gofermart/internal/config"
 	"github.com/learies/gofermart/internal/services"
 	"github.com/learies/gofermart/internal/storage"
 )
 
 type Handler struct {
-	user    storage.UserStorage
-	auth    services.AuthService
-	jwt     services.JWTService
-	order   storage.OrderStorage
-	balance storage.BalanceStorage
-	accrual services.AccrualService
-}
-
-func NewHandler(dbPool *pgxpool.Pool) *Handler {
-	return &Handler{
-		user:    storage.NewPostgresStorage(dbPool),
-		auth:    services.NewAuthService(),
-		jwt:     services.NewJWTService(),
-		order:   storage.NewOrderStorage(dbPool),
-		balance: storage.NewBalanceStorage(dbPool),
-		accrual: services.NewAccrualService(),
+	user     storage.UserStorage
+	auth     services.AuthService
+	jwt      services.JWTService
+	order    storage.OrderStorage
+	balance  storage.BalanceStorage
+	accrual  services.AccrualService
+	health   storage.HealthChecker
+	attempts storage.LoginAttemptStorage
+	totp     storage.TOTPStorage
+	apiKeys  storage.APIKeyStorage
+	jobs     storage.JobStorage
+	tx       storage.TxManager
+
+	auditor     services.AuditEmitter
+	auditEvents storage.AuditStorage
+
+	dbTimeout      time.Duration
+	accrualAddress string
+	secureCookies  bool
+
+	oidc                    services.OIDCService
+	totpService             services.TOTPService
+	totpWithdrawalThreshold float32
+
+	passwordPolicy *services.PasswordPolicy
+	lockout        atomic.Pointer[lockoutPolicies]
+	dummyHash      string
+}
+
+// lockoutPolicies are swapped as a whole when the configuration is reloaded.
+type lockoutPolicies struct {
+	login services.LockoutPolicy
+	ip    services.LockoutPolicy
+}
+
+func newLockoutPolicies(cfg *config.Config) *lockoutPolicies {
+	return &lockoutPolicies{
+		login: services.LockoutPolicy{
+			MaxAttempts: cfg.LoginMaxAttempts,
+			BaseDelay:   cfg.LoginLockoutBase,
+			MaxDelay:    cfg.LoginLockoutMax,
+			Window:      cfg.LoginAttemptWindow,
+		},
+		ip: services.LockoutPolicy{
+			MaxAttempts: cfg.LoginMaxAttemptsPerIP,
+			BaseDelay:   cfg.LoginLockoutBase,
+			MaxDelay:    cfg.LoginLockoutMax,
+			Window:      cfg.LoginAttemptWindow,
+		},
+	}
+}
+
+func NewHandler(store *storage.Storage, auth services.AuthService, cfg *config.Config) (*Handler, error) {
+	passwordPolicy, err := services.NewPasswordPolicy(cfg.PasswordMinLength, cfg.BreachedPasswordsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compared against when the login does not exist, so that a miss costs
+	// as much as a wrong password.
+	dummyHash, err := auth.HashPassword(randomString())
+	if err != nil {
+		return nil, err
+	}
+
+	totpService, err := services.NewTOTPService("Gophermart", cfg.TOTPEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var oidc services.OIDCService
+	if cfg.OIDCIssuerURL != "" {
+		oidc = services.NewOIDCService(services.OIDCConfig{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+		})
 	}
+
+	h := &Handler{
+		user:     store.Users,
+		auth:     auth,
+		jwt:      services.NewJWTService(cfg.JWTSecret),
+		order:    store.Orders,
+		balance:  store.Balance,
+		accrual:  services.NewAccrualService(),
+		health:   store.Health,
+		attempts: store.LoginAttempts,
+		totp:     store.TOTP,
+		apiKeys:  store.APIKeys,
+		jobs:     store.Jobs,
+		tx:       store.Tx,
+
+		auditor:     services.NewAuditEmitter(store.Audit),
+		auditEvents: store.Audit,
+
+		dbTimeout:      cfg.DBTimeout,
+		accrualAddress: cfg.AccrualSystemAddress,
+		secureCookies:  cfg.TLSEnabled(),
+
+		oidc:                    oidc,
+		totpService:             totpService,
+		totpWithdrawalThreshold: float32(cfg.TOTPWithdrawalThreshold),
+
+		passwordPolicy: passwordPolicy,
+		dummyHash:      dummyHash,
+	}
+	h.ApplyConfig(cfg)
+
+	return h, nil
+}
+
+// ApplyConfig takes over the reloadable settings of cfg.
+func (h *Handler) ApplyConfig(cfg *config.Config) {
+	h.lockout.Store(newLockoutPolicies(cfg))
+}
+
+// dbContext bounds the storage calls of a request by the configured timeout.
+// It is also cancelled when the client goes away.
+func (h *Handler) dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), h.dbTimeout)
+}
+
+// storageError answers a failed storage call: 503 when the storage is
+// unavailable or too slow, 500 otherwise.
+func storageError(w http.ResponseWriter, err error) {
+	if storage.IsUnavailable(err) {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/models"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+func writeHealth(w http.ResponseWriter, report models.HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == models.HealthUnavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Liveness answers as long as the process serves HTTP.
+func (h *Handler) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, models.HealthReport{Status: models.HealthOK})
+	}
+}
+
+// Readiness checks the dependencies. The service is unavailable without its
+// database, and only degraded without the accrual system, since orders are
+// polled again once it is back.
+func (h *Handler) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		var database, accrual models.HealthCheck
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			database = h.checkDatabase(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			accrual = h.checkAccrual(ctx)
+		}()
+		wg.Wait()
+
+		report := models.HealthReport{
+			Status: models.HealthOK,
+			Checks: []models.HealthCheck{database, accrual},
+		}
+		switch {
+		case database.Status != models.HealthOK:
+			report.Status = models.HealthUnavailable
+		case accrual.Status != models.HealthOK:
+			report.Status = models.HealthDegraded
+		}
+
+		writeHealth(w, report)
+	}
+}
+
+// runCheck times check. Error details are only logged, since the endpoint
+// is not authenticated.
+func runCheck(ctx context.Context, name string, check func() error) models.HealthCheck {
+	started := time.Now()
+	err := check()
+	result := models.HealthCheck{
+		Name:      name,
+		Status:    models.HealthOK,
+		LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+	}
+	if err != nil {
+		logger.Log.WarnContext(ctx, "Health check failed", "check", name, "error", err)
+		result.Status = models.HealthDown
+		result.Error = "unreachable"
+	}
+	return result
+}
+
+func (h *Handler) checkDatabase(ctx context.Context) models.HealthCheck {
+	var version int64
+	result := runCheck(ctx, "database", func() error {
+		if err := h.health.Ping(ctx); err != nil {
+			return err
+		}
+		var err error
+		version, err = h.health.SchemaVersion(ctx)
+		return err
+	})
+	result.SchemaVersion = version
+	return result
+}
+
+func (h *Handler) checkAccrual(ctx context.Context) models.HealthCheck {
+	return runCheck(ctx, "accrual", func() error {
+		return h.accrual.Ping(ctx, h.accrualAddress)
+	})
+}
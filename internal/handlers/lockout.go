@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/services"
+)
+
+const (
+	loginKeyPrefix          = "login:"
+	ipKeyPrefix             = "ip:"
+	passwordChangeKeyPrefix = "password:"
+)
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// lockedFor returns the longest remaining lockout among keys, or zero when none
+// of them is locked.
+//
+// A key whose attempts cannot be read counts as unlocked. This fails open on
+// purpose: the attempts live in the same database as the credentials, so an
+// outage that hides a lockout also fails the password lookup that follows,
+// while failing closed would turn every storage hiccup into a lockout of
+// all users.
+func (h *Handler) lockedFor(ctx context.Context, keys ...string) time.Duration {
+	now := time.Now()
+
+	var remaining time.Duration
+	for _, key := range keys {
+		attempt, err := h.attempts.GetLoginAttempt(ctx, key)
+		if err != nil {
+			logger.Log.ErrorContext(ctx, "Failed to get login attempts", "key", key, "error", err)
+			continue
+		}
+		if d := attempt.LockedUntil.Sub(now); d > remaining {
+			remaining = d
+		}
+	}
+
+	return remaining
+}
+
+func (h *Handler) registerLoginFailure(ctx context.Context, key string, policy services.LockoutPolicy) {
+	now := time.Now()
+
+	failures, err := h.attempts.RegisterLoginFailure(ctx, key, now, policy.Window)
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to register login failure", "key", key, "error", err)
+		return
+	}
+
+	lockFor := policy.LockDuration(failures)
+	if lockFor == 0 {
+		return
+	}
+
+	if err := h.attempts.LockLogin(ctx, key, now.Add(lockFor)); err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to lock login", "key", key, "error", err)
+		return
+	}
+
+	logger.Log.WarnContext(ctx, "Security event",
+		"event", "login_locked",
+		"key", key,
+		"failures", failures,
+		"locked_for", lockFor.String(),
+	)
+}
+
+func (h *Handler) resetLoginFailures(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := h.attempts.ResetLoginAttempts(ctx, key); err != nil {
+			logger.Log.ErrorContext(ctx, "Failed to reset login attempts", "key", key, "error", err)
+		}
+	}
+}
+
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
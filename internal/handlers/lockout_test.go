@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+const lockoutTestPassword = "correct horse battery"
+
+// newLockoutTestHandler returns a handler with the given lockout policies and
+// the users alice and bob, both with lockoutTestPassword.
+func newLockoutTestHandler(t *testing.T, login, ip services.LockoutPolicy) (*Handler, *storage.Storage) {
+	t.Helper()
+
+	h, store, _ := newOIDCTestHandler(t)
+	h.lockout.Store(&lockoutPolicies{login: login, ip: ip})
+
+	for _, login := range []string{"alice", "bob"} {
+		if _, err := store.Users.CreateUser(context.Background(), login, lockoutTestPassword); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h, store
+}
+
+func passwordLogin(h *Handler, ip, login, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.User{Username: login, Password: password})
+	req := httptest.NewRequest(http.MethodPost, "/api/user/login", bytes.NewReader(body))
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	h.LoginUser()(rec, req)
+	return rec
+}
+
+func lockoutPolicy(maxAttempts int) services.LockoutPolicy {
+	return services.LockoutPolicy{MaxAttempts: maxAttempts, BaseDelay: 10 * time.Second, MaxDelay: time.Hour, Window: time.Hour}
+}
+
+func TestLoginLockoutPerAccount(t *testing.T) {
+	h, _ := newLockoutTestHandler(t, lockoutPolicy(3), lockoutPolicy(100))
+
+	// Spreading the guesses over addresses does not avoid the account lock.
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		if rec := passwordLogin(h, ip, "alice", "wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec := passwordLogin(h, "192.0.2.4", "alice", lockoutTestPassword)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked account status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("Retry-After = %q, want %q", got, "10")
+	}
+
+	if rec := passwordLogin(h, "192.0.2.1", "bob", lockoutTestPassword); rec.Code != http.StatusOK {
+		t.Errorf("other account status = %d, want it unaffected: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	h, _ := newLockoutTestHandler(t, lockoutPolicy(100), lockoutPolicy(3))
+
+	// Spreading the guesses over accounts does not avoid the address lock.
+	for _, login := range []string{"alice", "bob", "carol"} {
+		if rec := passwordLogin(h, "192.0.2.1", login, "wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec := passwordLogin(h, "192.0.2.1", "alice", lockoutTestPassword)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked address status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After is not set")
+	}
+
+	if rec := passwordLogin(h, "192.0.2.2", "alice", lockoutTestPassword); rec.Code != http.StatusOK {
+		t.Errorf("other address status = %d, want it unaffected: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLoginSuccessResetsAccountFailures(t *testing.T) {
+	h, store := newLockoutTestHandler(t, lockoutPolicy(3), lockoutPolicy(100))
+	ctx := context.Background()
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 2; i++ {
+			passwordLogin(h, "192.0.2.1", "alice", "wrong")
+		}
+		if rec := passwordLogin(h, "192.0.2.1", "alice", lockoutTestPassword); rec.Code != http.StatusOK {
+			t.Fatalf("round %d: login status = %d, want the failures of the previous round forgotten: %s", round, rec.Code, rec.Body)
+		}
+	}
+
+	if attempt, err := store.LoginAttempts.GetLoginAttempt(ctx, loginKeyPrefix+"alice"); err != nil || attempt.Failures != 0 {
+		t.Errorf("account attempt = %+v, %v; want no failures", attempt, err)
+	}
+	// The address key is kept: one correct password must not clear the
+	// guesses made against other accounts.
+	if attempt, err := store.LoginAttempts.GetLoginAttempt(ctx, ipKeyPrefix+"192.0.2.1"); err != nil || attempt.Failures != 4 {
+		t.Errorf("address attempt = %+v, %v; want 4 failures", attempt, err)
+	}
+}
+
+func TestRegisterLoginFailureBacksOff(t *testing.T) {
+	policy := services.LockoutPolicy{MaxAttempts: 2, BaseDelay: 10 * time.Second, MaxDelay: 50 * time.Second, Window: time.Hour}
+	h, _ := newLockoutTestHandler(t, policy, policy)
+	ctx := context.Background()
+	key := loginKeyPrefix + "alice"
+
+	// The lock after the nth failure; the lock is checked with a margin for
+	// the time the test takes.
+	want := []time.Duration{0, 10 * time.Second, 20 * time.Second, 40 * time.Second, 50 * time.Second}
+	for i, want := range want {
+		h.registerLoginFailure(ctx, key, policy)
+
+		// lockedFor reports the longest lock among the keys.
+		got := h.lockedFor(ctx, ipKeyPrefix+"192.0.2.1", key)
+		if got > want || got < want-5*time.Second {
+			t.Errorf("after %d failures locked for %v, want %v", i+1, got, want)
+		}
+	}
+}
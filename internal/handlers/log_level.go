@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+)
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func writeLogLevel(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(logLevel{Level: logger.Level()})
+}
+
+// GetLogLevel returns the current minimum log level.
+func (h *Handler) GetLogLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeLogLevel(w)
+	}
+}
+
+// SetLogLevel changes the minimum log level until the next restart.
+func (h *Handler) SetLogLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var request logLevel
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Level == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		previous := logger.Level()
+		if err := logger.SetLevel(request.Level); err != nil {
+			http.Error(w, "Level must be one of debug, info, warn, error", http.StatusBadRequest)
+			return
+		}
+
+		logger.Log.InfoContext(r.Context(), "Log level changed", "from", previous, "to", logger.Level())
+		h.audit(r, models.AuditLogLevelChanged, UserID, map[string]string{"from": previous, "to": logger.Level()})
+
+		writeLogLevel(w)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/metrics"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+const (
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+// OIDCLogin redirects to the identity provider. When called from a logged-in
+// session the resulting identity is linked to the current user.
+func (h *Handler) OIDCLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.oidc == nil {
+			http.Error(w, "OpenID Connect login is not configured", http.StatusNotFound)
+			return
+		}
+
+		verifier, state, nonce, err := services.NewPKCEVerifier()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		linkUserID, _ := r.Context().Value(constants.UserIDKey).(int64)
+
+		authURL, err := h.oidc.AuthCodeURL(r.Context(), state, nonce, verifier)
+		if err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to build OIDC authorization URL", "error", err)
+			http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+			return
+		}
+
+		expirationTime := time.Now().Add(oidcFlowTTL)
+		http.SetCookie(w, &http.Cookie{
+			Name: oidcFlowCookie,
+			Value: h.jwt.GenerateOIDCFlowToken(services.OIDCFlow{
+				State:        state,
+				Nonce:        nonce,
+				CodeVerifier: verifier,
+				LinkUserID:   linkUserID,
+			}, expirationTime),
+			Expires:  expirationTime,
+			HttpOnly: true,
+			Secure:   h.secureCookies,
+			SameSite: http.SameSiteLaxMode,
+			Path:     "/api/user/oidc",
+		})
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+func (h *Handler) OIDCCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.oidc == nil {
+			http.Error(w, "OpenID Connect login is not configured", http.StatusNotFound)
+			return
+		}
+
+		cookie, err := r.Cookie(oidcFlowCookie)
+		if err != nil {
+			http.Error(w, "Login flow not found or expired", http.StatusBadRequest)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcFlowCookie,
+			Value:    "",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   h.secureCookies,
+			Path:     "/api/user/oidc",
+		})
+
+		flow, err := h.jwt.VerifyOIDCFlowToken(cookie.Value)
+		if err != nil {
+			http.Error(w, "Login flow not found or expired", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "oidc_state_mismatch", "ip", clientIP(r))
+			http.Error(w, "Invalid state", http.StatusBadRequest)
+			return
+		}
+
+		if providerErr := query.Get("error"); providerErr != "" {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "oidc_denied", "error", providerErr, "ip", clientIP(r))
+			http.Error(w, "Login was denied by the identity provider", http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := h.oidc.Exchange(r.Context(), query.Get("code"), flow.CodeVerifier, flow.Nonce)
+		if err != nil {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "oidc_exchange_failed", "error", err, "ip", clientIP(r))
+			http.Error(w, "Login with identity provider failed", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		UserID, err := h.resolveOIDCUser(ctx, identity, flow.LinkUserID)
+		if err != nil {
+			if errors.Is(err, storage.ErrConflict) {
+				http.Error(w, "Login is already taken; sign in with your password to link the account", http.StatusConflict)
+				return
+			}
+			logger.Log.ErrorContext(r.Context(), "Failed to resolve OIDC user", "error", err)
+			storageError(w, err)
+			return
+		}
+
+		dbUser, err := h.user.GetUserByID(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+
+		// The identity provider stands in for the password only; users with
+		// two-factor authentication still have to pass /login/2fa.
+		challenged, err := h.challengeSecondFactor(ctx, w, r, UserID, loginMethodOIDC)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if challenged {
+			return
+		}
+
+		logger.Log.InfoContext(r.Context(), "Security event", "event", "login_succeeded", "user_id", UserID, "ip", clientIP(r), "method", loginMethodOIDC)
+		h.audit(r, models.AuditLoginSucceeded, UserID, map[string]string{"method": loginMethodOIDC, "issuer": identity.Issuer})
+
+		h.setSessionCookie(w, dbUser.ID, dbUser.TokenVersion)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Login successful"))
+	}
+}
+
+// resolveOIDCUser returns the user owning identity, linking it to linkUserID
+// or creating a new user if nobody owns it yet.
+func (h *Handler) resolveOIDCUser(ctx context.Context, identity *services.OIDCIdentity, linkUserID int64) (int64, error) {
+	dbUser, err := h.user.GetUserByOIDCSubject(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return dbUser.ID, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return 0, err
+	}
+
+	if linkUserID != 0 {
+		if err := h.user.LinkOIDCSubject(ctx, linkUserID, identity.Issuer, identity.Subject); err != nil {
+			return 0, err
+		}
+		logger.Log.InfoContext(ctx, "Security event", "event", "oidc_linked", "user_id", linkUserID, "issuer", identity.Issuer)
+		return linkUserID, nil
+	}
+
+	username := identity.PreferredUsername
+	if username == "" {
+		username = identity.Email
+	}
+	if username == "" {
+		username = "oidc-" + identity.Subject
+	}
+
+	userID, err := h.user.CreateOIDCUser(ctx, strings.TrimSpace(username), identity.Issuer, identity.Subject)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.UsersRegistered.WithLabelValues("oidc").Inc()
+	logger.Log.InfoContext(ctx, "Security event", "event", "oidc_user_created", "user_id", userID, "issuer", identity.Issuer)
+	return userID, nil
+}
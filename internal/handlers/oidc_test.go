@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/learies/gofermart/internal/config"
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/services/oidctest"
+	"github.com/learies/gofermart/internal/storage"
+	"github.com/learies/gofermart/internal/storage/memory"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.NewLogger(logger.Options{Level: "error", Format: "text", Output: "stderr"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newOIDCTestHandler(t *testing.T) (*Handler, *storage.Storage, *oidctest.Issuer) {
+	t.Helper()
+
+	issuer := oidctest.NewIssuer(t, "gophermart", "client-secret")
+	auth := services.NewAuthService(services.HashOptions{BcryptCost: 4})
+	store := memory.New(auth)
+
+	h, err := NewHandler(store, auth, &config.Config{
+		DBTimeout:             time.Second,
+		LoginMaxAttempts:      5,
+		LoginMaxAttemptsPerIP: 50,
+		LoginLockoutBase:      time.Second,
+		LoginLockoutMax:       time.Minute,
+		LoginAttemptWindow:    time.Hour,
+		PasswordMinLength:     8,
+		JWTSecret:             "test-jwt-secret-0123456789abcdef0123",
+		TOTPEncryptionKey:     "test-totp-key-0123456789abcdef01234",
+		OIDCIssuerURL:         issuer.URL,
+		OIDCClientID:          issuer.ClientID,
+		OIDCClientSecret:      issuer.ClientSecret,
+		OIDCRedirectURL:       "https://gophermart.test/api/user/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, store, issuer
+}
+
+// oidcLogin runs the login flow through the handlers, from a session of
+// sessionUserID when it is not zero, and returns the callback response.
+func oidcLogin(t *testing.T, h *Handler, issuer *oidctest.Issuer, token oidctest.Token, sessionUserID int64) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/oidc/login", nil)
+	if sessionUserID != 0 {
+		req = req.WithContext(context.WithValue(req.Context(), constants.UserIDKey, sessionUserID))
+	}
+	rec := httptest.NewRecorder()
+	h.OIDCLogin()(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", rec.Code, rec.Body)
+	}
+
+	code, state, err := issuer.Authorize(rec.Header().Get("Location"), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := httptest.NewRequest(http.MethodGet,
+		"/api/user/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	h.OIDCCallback()(rec, callback)
+	return rec
+}
+
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" && cookie.Value != "" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	h, store, issuer := newOIDCTestHandler(t)
+	ctx := context.Background()
+
+	rec := oidcLogin(t, h, issuer, oidctest.Token{Subject: "subject-1", PreferredUsername: "alice"}, 0)
+	if rec.Code != http.StatusOK || sessionCookie(rec) == nil {
+		t.Fatalf("callback status = %d, session cookie = %v: %s", rec.Code, sessionCookie(rec), rec.Body)
+	}
+
+	user, err := store.Users.GetUserByOIDCSubject(ctx, issuer.URL, "subject-1")
+	if err != nil {
+		t.Fatalf("GetUserByOIDCSubject: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("username = %q, want %q", user.Username, "alice")
+	}
+
+	// A second login signs in to the same user.
+	if rec := oidcLogin(t, h, issuer, oidctest.Token{Subject: "subject-1", PreferredUsername: "alice"}, 0); rec.Code != http.StatusOK {
+		t.Fatalf("second callback status = %d: %s", rec.Code, rec.Body)
+	}
+	if again, err := store.Users.GetUserByOIDCSubject(ctx, issuer.URL, "subject-1"); err != nil || again.ID != user.ID {
+		t.Errorf("second login resolved to %+v, %v; want user %d", again, err, user.ID)
+	}
+}
+
+func TestOIDCCallbackLinksSessionUser(t *testing.T) {
+	h, store, issuer := newOIDCTestHandler(t)
+	ctx := context.Background()
+
+	userID, err := store.Users.CreateUser(ctx, "bob", "Password123!x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := oidcLogin(t, h, issuer, oidctest.Token{Subject: "subject-2", PreferredUsername: "bob-at-idp"}, userID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d: %s", rec.Code, rec.Body)
+	}
+
+	user, err := store.Users.GetUserByOIDCSubject(ctx, issuer.URL, "subject-2")
+	if err != nil {
+		t.Fatalf("GetUserByOIDCSubject: %v", err)
+	}
+	if user.ID != userID {
+		t.Errorf("identity linked to user %d, want %d", user.ID, userID)
+	}
+	if _, err := store.Users.GetUserByUsername(ctx, "bob-at-idp"); err == nil {
+		t.Error("linking created a new user")
+	}
+}
+
+func TestOIDCCallbackRequiresSecondFactor(t *testing.T) {
+	h, store, issuer := newOIDCTestHandler(t)
+	ctx := context.Background()
+
+	// The first login creates the user, who then enables 2FA.
+	if rec := oidcLogin(t, h, issuer, oidctest.Token{Subject: "subject-3", PreferredUsername: "carol"}, 0); rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d: %s", rec.Code, rec.Body)
+	}
+	user, err := store.Users.GetUserByOIDCSubject(ctx, issuer.URL, "subject-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := h.totpService.SealSecret("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TOTP.SaveTOTPSecret(ctx, user.ID, secret, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TOTP.EnableTOTP(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := oidcLogin(t, h, issuer, oidctest.Token{Subject: "subject-3", PreferredUsername: "carol"}, 0)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d: %s", rec.Code, rec.Body)
+	}
+	if cookie := sessionCookie(rec); cookie != nil {
+		t.Fatal("session issued without the second factor")
+	}
+
+	var challenge models.LoginChallenge
+	if err := json.NewDecoder(rec.Body).Decode(&challenge); err != nil {
+		t.Fatalf("decode challenge: %v", err)
+	}
+	if !challenge.TwoFactorRequired || challenge.Challenge == "" {
+		t.Fatalf("challenge = %+v, want a two-factor challenge", challenge)
+	}
+	claims, err := h.jwt.VerifyChallengeToken(challenge.Challenge)
+	if err != nil || claims.UserID != user.ID || claims.Method != loginMethodOIDC {
+		t.Errorf("challenge token = %+v, %v; want user %d, method %q", claims, err, user.ID, loginMethodOIDC)
+	}
+}
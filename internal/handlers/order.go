@@ -6,16 +6,26 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
+
+	"github.com/go-chi/chi"
 
 	"github.com/learies/gofermart/internal/config/logger"
 	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/metrics"
 	"github.com/learies/gofermart/internal/models"
 	"github.com/learies/gofermart/internal/services"
 	"github.com/learies/gofermart/internal/storage"
 )
 
+// withdrawTxOptions makes concurrent withdrawals of one user conflict rather
+// than both pass the balance check.
+var withdrawTxOptions = storage.TxOptions{
+	Isolation:  storage.Serializable,
+	MaxRetries: 3,
+}
+
 func (h *Handler) CreateOrder(AccrualSystemAddress string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -32,10 +42,17 @@ func (h *Handler) CreateOrder(AccrualSystemAddress string) http.HandlerFunc {
 			return
 		}
 
-		order := h.order.GetOrder(orderNumber)
+		ctx, cancel := h.dbContext(r)
+		order, err := h.order.GetOrder(ctx, orderNumber)
+		cancel()
+		if err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to get order", "order", orderNumber, "error", err)
+			storageError(w, err)
+			return
+		}
 
 		if !services.ValidateOrderNumber(orderNumber) {
-			logger.Log.Error("Invalid order number", "order", orderNumber)
+			logger.Log.ErrorContext(r.Context(), "Invalid order number", "order", orderNumber)
 			http.Error(w, "Invalid order number", http.StatusUnprocessableEntity)
 			return
 		}
@@ -53,7 +70,7 @@ func (h *Handler) CreateOrder(AccrualSystemAddress string) http.HandlerFunc {
 			}
 		}
 
-		orderChan, errChan := h.accrual.FetchOrder(AccrualSystemAddress, orderNumber)
+		orderChan, errChan := h.accrual.FetchOrder(r.Context(), AccrualSystemAddress, orderNumber)
 
 		orderInfo := models.Order{}
 
@@ -74,16 +91,24 @@ func (h *Handler) CreateOrder(AccrualSystemAddress string) http.HandlerFunc {
 			}
 		}
 
-		err = h.order.CreateOrder(orderInfo)
+		ctx, cancel = h.dbContext(r)
+		defer cancel()
+
+		err = h.order.CreateOrder(ctx, orderInfo)
 		if err != nil {
 			if errors.Is(err, storage.ErrConflict) {
 				http.Error(w, "We already have that order", http.StatusOK)
 				return
 			}
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			storageError(w, err)
 			return
 		}
 
+		metrics.OrdersUploaded.Inc()
+		if orderInfo.Status == "PROCESSED" {
+			metrics.PointsAccrued.Add(float64(orderInfo.Accrual))
+		}
+
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusAccepted)
 		w.Write([]byte("New order number has been accepted for processing"))
@@ -92,25 +117,31 @@ func (h *Handler) CreateOrder(AccrualSystemAddress string) http.HandlerFunc {
 
 func (h *Handler) GetUserOrders() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		ctx, cancel := h.dbContext(r)
 		defer cancel()
 
 		UserID, ok := ctx.Value(constants.UserIDKey).(int64)
 		if !ok {
-			logger.Log.Error("User is not authenticated")
+			logger.Log.ErrorContext(r.Context(), "User is not authenticated")
 			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
 			return
 		}
 
+		// Без параметров отдаём весь список, как того требует спецификация
+		if r.URL.RawQuery != "" {
+			h.listUserOrders(w, r, UserID)
+			return
+		}
+
 		userOrders, err := h.order.GetUserOrders(ctx, UserID)
 		if err != nil {
-			logger.Log.Error("Failed to get user orders", "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			logger.Log.ErrorContext(r.Context(), "Failed to get user orders", "error", err)
+			storageError(w, err)
 			return
 		}
 
 		if len(*userOrders) == 0 {
-			logger.Log.Info("No user orders found")
+			logger.Log.InfoContext(r.Context(), "No user orders found")
 			http.Error(w, "No user orders found", http.StatusNoContent)
 			return
 		}
@@ -121,6 +152,80 @@ func (h *Handler) GetUserOrders() http.HandlerFunc {
 	}
 }
 
+func (h *Handler) listUserOrders(w http.ResponseWriter, r *http.Request, userID int64) {
+	query, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	// Лишняя запись показывает, есть ли следующая страница
+	pageSize := query.Limit
+	query.Limit++
+
+	orders, err := h.order.ListUserOrders(ctx, userID, query)
+	if err != nil {
+		logger.Log.ErrorContext(r.Context(), "Failed to list user orders", "error", err)
+		storageError(w, err)
+		return
+	}
+
+	if len(orders) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if len(orders) > pageSize {
+		orders = orders[:pageSize]
+		setNextPageLink(w, r, orders[pageSize-1])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(orders)
+}
+
+func (h *Handler) GetUserOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		// Чужой заказ неотличим от несуществующего
+		timeline, err := h.order.GetUserOrder(ctx, UserID, chi.URLParam(r, "number"))
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, "Order not found", http.StatusNotFound)
+				return
+			}
+			logger.Log.ErrorContext(r.Context(), "Failed to get user order", "error", err)
+			storageError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(timeline)
+	}
+}
+
+// errTOTPReused means that the code of a withdrawal was used by a concurrent
+// request.
+var errTOTPReused = errors.New("TOTP code already used")
+
+func (h *Handler) rejectWithdrawalTOTP(w http.ResponseWriter, r *http.Request, userID int64) {
+	logger.Log.WarnContext(r.Context(), "Security event", "event", "withdrawal_totp_failed", "user_id", userID, "ip", clientIP(r))
+	http.Error(w, "A valid TOTP code is required in X-TOTP-Code", http.StatusForbidden)
+}
+
 func (h *Handler) Withdraw(AccrualSystemAddress string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var withdraw models.WithdrawRequest
@@ -132,7 +237,7 @@ func (h *Handler) Withdraw(AccrualSystemAddress string) http.HandlerFunc {
 
 		// Декодирование тела запроса
 		if err := json.NewDecoder(r.Body).Decode(&withdraw); err != nil {
-			logger.Log.Error("Failed to decode request body", "error", err)
+			logger.Log.ErrorContext(r.Context(), "Failed to decode request body", "error", err)
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
@@ -140,13 +245,40 @@ func (h *Handler) Withdraw(AccrualSystemAddress string) http.HandlerFunc {
 		// Проверка аутентификации пользователя
 		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
 		if !ok {
-			logger.Log.Error("User is not authenticated")
+			logger.Log.ErrorContext(r.Context(), "User is not authenticated")
 			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
 			return
 		}
 
+		// Крупные списания требуют свежего TOTP-кода. Код помечается
+		// использованным в транзакции списания, чтобы неудачное списание
+		// его не сжигало
+		var totpStep int64
+		if withdraw.SumWithdrawn > h.totpWithdrawalThreshold {
+			ctx, cancel := h.dbContext(r)
+			defer cancel()
+
+			totp, err := h.totp.GetTOTP(ctx, UserID)
+			if err != nil {
+				storageError(w, err)
+				return
+			}
+			if totp.Enabled {
+				step, ok, err := h.matchTOTP(totp, r.Header.Get("X-TOTP-Code"))
+				if err != nil {
+					storageError(w, err)
+					return
+				}
+				if !ok {
+					h.rejectWithdrawalTOTP(w, r, UserID)
+					return
+				}
+				totpStep = step
+			}
+		}
+
 		// Получение информации о заказе в отдельной горутине
-		orderChan, errChan := h.accrual.FetchOrder(AccrualSystemAddress, withdraw.OrderNumber)
+		orderChan, errChan := h.accrual.FetchOrder(r.Context(), AccrualSystemAddress, withdraw.OrderNumber)
 
 		orderInfo := models.Order{}
 
@@ -169,26 +301,52 @@ func (h *Handler) Withdraw(AccrualSystemAddress string) http.HandlerFunc {
 			}
 		}
 
-		// Создание нового заказа
-		if err := h.order.CreateOrder(orderInfo); err != nil {
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		// Списание и проверка баланса в одной транзакции: при нехватке
+		// средств списание откатывается
+		err := h.tx.WithinTx(ctx, withdrawTxOptions, func(ctx context.Context, tx *storage.Storage) error {
+			if totpStep != 0 {
+				if err := tx.TOTP.UseTOTPStep(ctx, UserID, totpStep); err != nil {
+					if errors.Is(err, storage.ErrConflict) {
+						return errTOTPReused
+					}
+					return err
+				}
+			}
+			if err := tx.Orders.CreateOrder(ctx, orderInfo); err != nil {
+				return err
+			}
+			return tx.Balance.CheckBalanceWithdrawal(ctx, UserID, withdraw.SumWithdrawn)
+		})
+		if err != nil {
+			if errors.Is(err, errTOTPReused) {
+				h.rejectWithdrawalTOTP(w, r, UserID)
+				return
+			}
 			if errors.Is(err, storage.ErrConflict) {
 				http.Error(w, "We already have that order", http.StatusOK)
 				return
 			}
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-
-		// Проверка возможности снятия средств с баланса
-		if err := h.balance.CheckBalanceWithdrawal(UserID, withdraw.SumWithdrawn); err != nil {
 			if errors.Is(err, storage.ErrInsufficientFunds) {
 				http.Error(w, "Withdrawal amount exceeds the order accrual", http.StatusPaymentRequired)
 				return
 			}
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			storageError(w, err)
 			return
 		}
 
+		metrics.PointsWithdrawn.Add(float64(withdraw.SumWithdrawn))
+		if orderInfo.Status == "PROCESSED" {
+			metrics.PointsAccrued.Add(float64(orderInfo.Accrual))
+		}
+
+		h.audit(r, models.AuditWithdrawal, UserID, map[string]string{
+			"order": withdraw.OrderNumber,
+			"sum":   strconv.FormatFloat(float64(withdraw.SumWithdrawn), 'f', 2, 32),
+		})
+
 		// Установка заголовков и ответ клиенту
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
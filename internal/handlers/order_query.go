@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+const (
+	defaultOrdersPageSize = 100
+	maxOrdersPageSize     = 1000
+)
+
+var orderStatuses = []string{"NEW", "PROCESSING", "INVALID", "PROCESSED"}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// parseOrderQuery reads the paging and filter parameters of GET /orders:
+// limit, cursor, status (comma-separated), from and to (RFC 3339, to is
+// exclusive) and sort (asc or desc by upload time, desc by default).
+func parseOrderQuery(values url.Values) (models.OrderQuery, error) {
+	query := models.OrderQuery{Limit: defaultOrdersPageSize}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxOrdersPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxOrdersPageSize)
+		}
+		query.Limit = n
+	}
+
+	if statuses := values.Get("status"); statuses != "" {
+		for _, status := range strings.Split(statuses, ",") {
+			status = strings.ToUpper(strings.TrimSpace(status))
+			if !slices.Contains(orderStatuses, status) {
+				return query, fmt.Errorf("unknown status %q", status)
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+
+	for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := values.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*target = t.UTC()
+		}
+	}
+
+	switch values.Get("sort") {
+	case "", "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		return query, errors.New("sort must be asc or desc")
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		after, err := decodeOrderCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	return query, nil
+}
+
+func encodeOrderCursor(order models.OrderResponse) string {
+	data, _ := json.Marshal(models.OrderCursor{UploadedAt: order.UploadedAt, OrderID: order.OrderID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeOrderCursor(cursor string) (*models.OrderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var after models.OrderCursor
+	if err := json.Unmarshal(data, &after); err != nil || after.OrderID == "" {
+		return nil, errInvalidCursor
+	}
+	return &after, nil
+}
+
+// setNextPageLink points the Link header at the page that follows last,
+// keeping the filters of the current request.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, last models.OrderResponse) {
+	values := r.URL.Query()
+	values.Set("cursor", encodeOrderCursor(last))
+
+	next := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+)
+
+func TestParseOrderQuery(t *testing.T) {
+	cursorOrder := models.OrderResponse{OrderID: "12345678903", UploadedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	cursor := encodeOrderCursor(cursorOrder)
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		query   string
+		want    models.OrderQuery
+		wantErr string
+	}{
+		{name: "defaults", query: "", want: models.OrderQuery{Limit: defaultOrdersPageSize}},
+		{name: "limit", query: "limit=5", want: models.OrderQuery{Limit: 5}},
+		{name: "largest limit", query: "limit=1000", want: models.OrderQuery{Limit: maxOrdersPageSize}},
+		{name: "zero limit", query: "limit=0", wantErr: "limit must be"},
+		{name: "limit too large", query: "limit=1001", wantErr: "limit must be"},
+		{name: "limit not a number", query: "limit=ten", wantErr: "limit must be"},
+		{
+			name:  "statuses",
+			query: "status=new,%20Processed",
+			want:  models.OrderQuery{Limit: defaultOrdersPageSize, Statuses: []string{"NEW", "PROCESSED"}},
+		},
+		{name: "unknown status", query: "status=NEW,DONE", wantErr: `unknown status "DONE"`},
+		{
+			name:  "time range in UTC",
+			query: "from=2024-05-01T12:00:00%2B02:00&to=2024-06-01T00:00:00Z",
+			want: models.OrderQuery{
+				Limit: defaultOrdersPageSize,
+				From:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+				To:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{name: "malformed from", query: "from=2024-05-01", wantErr: "from must be"},
+		{name: "malformed to", query: "to=yesterday", wantErr: "to must be"},
+		{name: "ascending", query: "sort=asc", want: models.OrderQuery{Limit: defaultOrdersPageSize, Ascending: true}},
+		{name: "descending", query: "sort=desc", want: models.OrderQuery{Limit: defaultOrdersPageSize}},
+		{name: "unknown sort", query: "sort=status", wantErr: "sort must be"},
+		{
+			name:  "cursor",
+			query: "cursor=" + cursor,
+			want: models.OrderQuery{
+				Limit: defaultOrdersPageSize,
+				After: &models.OrderCursor{UploadedAt: cursorOrder.UploadedAt, OrderID: cursorOrder.OrderID},
+			},
+		},
+		{name: "cursor not base64", query: "cursor=%21%21", wantErr: errInvalidCursor.Error()},
+		{name: "cursor not JSON", query: "cursor=" + encode("12345678903"), wantErr: errInvalidCursor.Error()},
+		{name: "cursor without order", query: "cursor=" + encode(`{"uploaded_at":"2024-05-01T10:00:00Z"}`), wantErr: errInvalidCursor.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseOrderQuery(values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+var nextLink = regexp.MustCompile(`^<([^>]+)>; rel="next"$`)
+
+func TestListUserOrdersFollowsLinks(t *testing.T) {
+	h, store, _ := newOIDCTestHandler(t)
+	ctx := context.Background()
+
+	userID, err := store.Users.CreateUser(ctx, "alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := store.Users.CreateUser(ctx, "bob", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := []models.Order{
+		{OrderID: "12345678903", Status: "NEW", UserID: userID},
+		{OrderID: "9278923470", Status: "PROCESSED", Accrual: 10, UserID: userID},
+		{OrderID: "2377225624", Status: "NEW", UserID: userID},
+		{OrderID: "346436439", Status: "NEW", UserID: otherID},
+		{OrderID: "4561261212345467", Status: "NEW", UserID: userID},
+		{OrderID: "79927398713", Status: "INVALID", UserID: userID},
+	}
+	for _, order := range orders {
+		if err := store.Orders.CreateOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+		// Distinct upload times keep the expected order independent of the
+		// tie-break on the order number.
+		time.Sleep(time.Millisecond)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "limit=2&sort=asc", want: []string{"12345678903", "9278923470", "2377225624", "4561261212345467", "79927398713"}},
+		{query: "limit=2", want: []string{"79927398713", "4561261212345467", "2377225624", "9278923470", "12345678903"}},
+		{query: "limit=1&status=NEW&sort=asc", want: []string{"12345678903", "2377225624", "4561261212345467"}},
+		{query: "limit=5", want: []string{"79927398713", "4561261212345467", "2377225624", "9278923470", "12345678903"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got []string
+			target := "/api/user/orders?" + tt.query
+			for pages := 0; target != ""; pages++ {
+				if pages > len(tt.want) {
+					t.Fatalf("more than %d pages", len(tt.want))
+				}
+
+				req := httptest.NewRequest(http.MethodGet, target, nil)
+				req = req.WithContext(context.WithValue(req.Context(), constants.UserIDKey, userID))
+				rec := httptest.NewRecorder()
+				h.GetUserOrders()(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("GET %s status = %d: %s", target, rec.Code, rec.Body)
+				}
+
+				var page []models.OrderResponse
+				if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+					t.Fatal(err)
+				}
+				for _, order := range page {
+					got = append(got, order.OrderID)
+				}
+
+				target = ""
+				if link := rec.Header().Get("Link"); link != "" {
+					match := nextLink.FindStringSubmatch(link)
+					if match == nil {
+						t.Fatalf("Link = %q", link)
+					}
+					target = match[1]
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orders = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+const (
+	challengeTTL       = 5 * time.Minute
+	recoveryCodesCount = 10
+	twoFactorKeyPrefix = "2fa:"
+)
+
+// First factors of a login.
+const (
+	loginMethodPassword = "password"
+	loginMethodOIDC     = "oidc"
+)
+
+// challengeSecondFactor answers the first factor of a login with a challenge
+// to complete at /login/2fa if the user has two-factor authentication, and
+// reports whether it did.
+func (h *Handler) challengeSecondFactor(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, method string) (bool, error) {
+	totp, err := h.totp.GetTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !totp.Enabled {
+		return false, nil
+	}
+	tokenVersion, err := h.user.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	logger.Log.InfoContext(r.Context(), "Security event", "event", "login_challenged", "user_id", userID, "ip", clientIP(r), "method", method)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.LoginChallenge{
+		TwoFactorRequired: true,
+		Challenge:         h.jwt.GenerateChallengeToken(userID, tokenVersion, method, time.Now().Add(challengeTTL)),
+	})
+	return true, nil
+}
+
+// matchTOTP returns the step of code if it is current and newer than the last
+// one used, without consuming it.
+func (h *Handler) matchTOTP(totp *models.TOTP, code string) (int64, bool, error) {
+	secret, err := h.totpService.OpenSecret(totp.Secret)
+	if err != nil {
+		return 0, false, err
+	}
+	step, ok := h.totpService.Validate(secret, code, time.Now())
+	return step, ok && step > totp.LastStep, nil
+}
+
+// verifyTOTP accepts a current TOTP code exactly once.
+func (h *Handler) verifyTOTP(ctx context.Context, totp *models.TOTP, code string) (bool, error) {
+	step, ok, err := h.matchTOTP(totp, code)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := h.totp.UseTOTPStep(ctx, totp.UserID, step); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (h *Handler) verifySecondFactor(ctx context.Context, totp *models.TOTP, code string) (bool, error) {
+	ok, err := h.verifyTOTP(ctx, totp, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	if err := h.totp.UseRecoveryCode(ctx, totp.UserID, services.HashRecoveryCode(code)); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	logger.Log.InfoContext(ctx, "Security event", "event", "recovery_code_used", "user_id", totp.UserID)
+	return true, nil
+}
+
+func (h *Handler) EnrollTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		totp, err := h.totp.GetTOTP(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if totp.Enabled {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		dbUser, err := h.user.GetUserByID(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+
+		secret, err := h.totpService.GenerateSecret()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		recoveryCodes, err := h.totpService.GenerateRecoveryCodes(recoveryCodesCount)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		recoveryCodeHashes := make([]string, len(recoveryCodes))
+		for i, code := range recoveryCodes {
+			recoveryCodeHashes[i] = services.HashRecoveryCode(code)
+		}
+
+		sealedSecret, err := h.totpService.SealSecret(secret)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := h.totp.SaveTOTPSecret(ctx, UserID, sealedSecret, recoveryCodeHashes); err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to save TOTP secret", "error", err)
+			storageError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.TOTPEnrolment{
+			Secret:        secret,
+			URI:           h.totpService.ProvisioningURI(secret, dbUser.Username),
+			RecoveryCodes: recoveryCodes,
+		})
+	}
+}
+
+func (h *Handler) ConfirmTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var request models.TOTPCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		totp, err := h.totp.GetTOTP(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if totp.Secret == "" {
+			http.Error(w, "Two-factor enrolment has not been started", http.StatusConflict)
+			return
+		}
+		if totp.Enabled {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		ok, err = h.verifyTOTP(ctx, totp, request.Code)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusUnprocessableEntity)
+			return
+		}
+
+		if err := h.totp.EnableTOTP(ctx, UserID); err != nil {
+			storageError(w, err)
+			return
+		}
+
+		logger.Log.InfoContext(r.Context(), "Security event", "event", "totp_enabled", "user_id", UserID, "ip", clientIP(r))
+		h.audit(r, models.AuditTOTPEnabled, UserID, nil)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Two-factor authentication enabled"))
+	}
+}
+
+func (h *Handler) DisableTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var request models.TOTPCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		totp, err := h.totp.GetTOTP(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if !totp.Enabled {
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+			return
+		}
+
+		ok, err = h.verifySecondFactor(ctx, totp, request.Code)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusForbidden)
+			return
+		}
+
+		if err := h.totp.DisableTOTP(ctx, UserID); err != nil {
+			storageError(w, err)
+			return
+		}
+
+		logger.Log.WarnContext(r.Context(), "Security event", "event", "totp_disabled", "user_id", UserID, "ip", clientIP(r))
+		h.audit(r, models.AuditTOTPDisabled, UserID, nil)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Two-factor authentication disabled"))
+	}
+}
+
+func (h *Handler) LoginTwoFactor() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.TwoFactorLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		challenge, err := h.jwt.VerifyChallengeToken(request.Challenge)
+		if err != nil {
+			http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+			return
+		}
+		UserID, method := challenge.UserID, challenge.Method
+		if method == "" {
+			method = loginMethodPassword
+		}
+
+		ip := clientIP(r)
+		key := twoFactorKeyPrefix + strconv.FormatInt(UserID, 10)
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		if remaining := h.lockedFor(ctx, key); remaining > 0 {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "totp_rejected_locked", "user_id", UserID, "ip", ip)
+			h.audit(r, models.AuditLoginFailed, UserID, map[string]string{"reason": "locked", "second_factor": "true"})
+			w.Header().Set("Retry-After", retryAfter(remaining))
+			http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+			return
+		}
+
+		totp, err := h.totp.GetTOTP(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		dbUser, err := h.user.GetUserByID(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		// The challenge dies with the state it was issued for: once two-factor
+		// authentication is disabled, or the password changed, it no longer
+		// proves anything. A pending enrolment is not enabled either, so its
+		// codes cannot complete a login.
+		if !totp.Enabled || dbUser.TokenVersion != challenge.TokenVersion {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "totp_challenge_stale", "user_id", UserID, "ip", ip)
+			http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+			return
+		}
+
+		ok, err := h.verifySecondFactor(ctx, totp, request.Code)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if !ok {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "totp_failed", "user_id", UserID, "ip", ip)
+			h.audit(r, models.AuditLoginFailed, UserID, map[string]string{"reason": "invalid_code", "second_factor": "true"})
+			h.registerLoginFailure(ctx, key, h.lockout.Load().login)
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		h.resetLoginFailures(ctx, key)
+		logger.Log.InfoContext(r.Context(), "Security event", "event", "login_succeeded", "user_id", UserID, "ip", ip, "method", method, "second_factor", true)
+		h.audit(r, models.AuditLoginSucceeded, UserID, map[string]string{"method": method, "second_factor": "true"})
+
+		h.setSessionCookie(w, dbUser.ID, dbUser.TokenVersion)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Login successful"))
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+const testRecoveryCode = "abcde-fghij"
+
+// enrolTOTP enables two-factor authentication for a new user, with
+// testRecoveryCode as its only recovery code.
+func enrolTOTP(t *testing.T, h *Handler, store *storage.Storage, enable bool) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	userID, err := store.Users.CreateUser(ctx, "totp-user", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := h.totpService.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := h.totpService.SealSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TOTP.SaveTOTPSecret(ctx, userID, sealed, []string{services.HashRecoveryCode(testRecoveryCode)}); err != nil {
+		t.Fatal(err)
+	}
+	if enable {
+		if err := store.TOTP.EnableTOTP(ctx, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userID
+}
+
+func loginTwoFactor(h *Handler, challenge string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.TwoFactorLoginRequest{Challenge: challenge, Code: testRecoveryCode})
+	rec := httptest.NewRecorder()
+	h.LoginTwoFactor()(rec, httptest.NewRequest(http.MethodPost, "/api/user/login/2fa", bytes.NewReader(body)))
+	return rec
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare changes the user after the challenge was issued for
+		// token version 0.
+		prepare    func(t *testing.T, store *storage.Storage, userID int64)
+		enabled    bool
+		wantStatus int
+	}{
+		{name: "valid challenge", enabled: true, wantStatus: http.StatusOK},
+		{name: "pending enrolment", wantStatus: http.StatusUnauthorized},
+		{
+			name:    "disabled after the challenge",
+			enabled: true,
+			prepare: func(t *testing.T, store *storage.Storage, userID int64) {
+				if err := store.TOTP.DisableTOTP(context.Background(), userID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:    "password changed after the challenge",
+			enabled: true,
+			prepare: func(t *testing.T, store *storage.Storage, userID int64) {
+				if _, err := store.Users.UpdatePassword(context.Background(), userID, "new-hash"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, _ := newOIDCTestHandler(t)
+			userID := enrolTOTP(t, h, store, tt.enabled)
+			challenge := h.jwt.GenerateChallengeToken(userID, 0, loginMethodPassword, time.Now().Add(challengeTTL))
+			if tt.prepare != nil {
+				tt.prepare(t, store, userID)
+			}
+
+			rec := loginTwoFactor(h, challenge)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := sessionCookie(rec) != nil; got != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("session cookie set = %v", got)
+			}
+		})
+	}
+}
+
+func TestLoginTwoFactorStaleChallengeKeepsRecoveryCode(t *testing.T) {
+	h, store, _ := newOIDCTestHandler(t)
+	userID := enrolTOTP(t, h, store, true)
+	stale := h.jwt.GenerateChallengeToken(userID, 0, loginMethodPassword, time.Now().Add(challengeTTL))
+
+	version, err := store.Users.UpdatePassword(context.Background(), userID, "new-hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := loginTwoFactor(h, stale); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("stale challenge status = %d: %s", rec.Code, rec.Body)
+	}
+
+	fresh := h.jwt.GenerateChallengeToken(userID, version, loginMethodPassword, time.Now().Add(challengeTTL))
+	if rec := loginTwoFactor(h, fresh); rec.Code != http.StatusOK {
+		t.Fatalf("fresh challenge status = %d, want the recovery code to be unused: %s", rec.Code, rec.Body)
+	}
+}
@@ -1,16 +1,35 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/metrics"
 	"github.com/learies/gofermart/internal/models"
 	"github.com/learies/gofermart/internal/storage"
 )
 
-var expirationTime = time.Now().Add(24 * time.Hour)
+const sessionTTL = 24 * time.Hour
+
+func (h *Handler) setSessionCookie(w http.ResponseWriter, userID int64, tokenVersion int) {
+	expirationTime := time.Now().Add(sessionTTL)
+	token := h.jwt.GenerateToken(userID, tokenVersion, expirationTime)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    token,
+		Expires:  expirationTime,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		Path:     "/",
+	})
+}
 
 func (h *Handler) RegisterUser() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -21,24 +40,27 @@ func (h *Handler) RegisterUser() http.HandlerFunc {
 			return
 		}
 
-		userID, err := h.user.CreateUser(user.Username, user.Password)
+		if err := h.passwordPolicy.Validate(user.Username, user.Password); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		userID, err := h.user.CreateUser(ctx, user.Username, user.Password)
 		if err != nil {
 			if errors.Is(err, storage.ErrConflict) {
 				http.Error(w, "User already exists", http.StatusConflict)
 				return
 			}
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			storageError(w, err)
 			return
 		}
 
-		token := h.jwt.GenerateToken(userID, expirationTime)
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    token,
-			Expires:  expirationTime,
-			HttpOnly: true,
-			Path:     "/",
-		})
+		metrics.UsersRegistered.WithLabelValues("password").Inc()
+		h.audit(r, models.AuditUserRegistered, userID, map[string]string{"login": user.Username})
+		h.setSessionCookie(w, userID, 0)
 
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
@@ -60,29 +82,154 @@ func (h *Handler) LoginUser() http.HandlerFunc {
 			return
 		}
 
-		dbUser, err := h.user.GetUserByUsername(user.Username)
-		if err != nil {
-			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		ip := clientIP(r)
+		loginKey := loginKeyPrefix + user.Username
+		ipKey := ipKeyPrefix + ip
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		if remaining := h.lockedFor(ctx, loginKey, ipKey); remaining > 0 {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "login_rejected_locked", "login", user.Username, "ip", ip)
+			h.audit(r, models.AuditLoginFailed, 0, map[string]string{"login": user.Username, "reason": "locked"})
+			w.Header().Set("Retry-After", retryAfter(remaining))
+			http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
 			return
 		}
 
-		if err := h.auth.VerifyPassword(dbUser.Password, user.Password); err != nil {
+		passwordHash := h.dummyHash
+		dbUser, err := h.user.GetUserByUsername(ctx, user.Username)
+		switch {
+		case err == nil:
+			passwordHash = dbUser.Password
+		case !errors.Is(err, storage.ErrNotFound):
+			// An outage must not be reported, or counted, as a wrong password.
+			logger.Log.ErrorContext(r.Context(), "Failed to get user", "login", user.Username, "error", err)
+			storageError(w, err)
+			return
+		}
+
+		if err := h.auth.VerifyPassword(passwordHash, user.Password); err != nil || dbUser == nil {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "login_failed", "login", user.Username, "ip", ip)
+			var userID int64
+			if dbUser != nil {
+				userID = dbUser.ID
+			}
+			h.audit(r, models.AuditLoginFailed, userID, map[string]string{"login": user.Username, "reason": "invalid_credentials"})
+			lockout := h.lockout.Load()
+			h.registerLoginFailure(ctx, loginKey, lockout.login)
+			h.registerLoginFailure(ctx, ipKey, lockout.ip)
 			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 			return
 		}
 
-		token := h.jwt.GenerateToken(dbUser.ID, expirationTime)
+		h.resetLoginFailures(ctx, loginKey)
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    token,
-			Expires:  expirationTime,
-			HttpOnly: true,
-			Path:     "/",
-		})
+		if h.auth.NeedsRehash(dbUser.Password) {
+			h.rehashPassword(ctx, dbUser.ID, user.Password)
+		}
+
+		challenged, err := h.challengeSecondFactor(ctx, w, r, dbUser.ID, loginMethodPassword)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+		if challenged {
+			return
+		}
+
+		logger.Log.InfoContext(r.Context(), "Security event", "event", "login_succeeded", "user_id", dbUser.ID, "ip", ip)
+		h.audit(r, models.AuditLoginSucceeded, dbUser.ID, map[string]string{"method": loginMethodPassword})
+
+		h.setSessionCookie(w, dbUser.ID, dbUser.TokenVersion)
 
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Login successful"))
 	}
 }
+
+func (h *Handler) rehashPassword(ctx context.Context, userID int64, password string) {
+	hashedPassword, err := h.auth.HashPassword(password)
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to rehash password", "user_id", userID, "error", err)
+		return
+	}
+
+	if err := h.user.UpdatePasswordHash(ctx, userID, hashedPassword); err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to store rehashed password", "user_id", userID, "error", err)
+		return
+	}
+
+	logger.Log.InfoContext(ctx, "Password rehashed", "user_id", userID)
+}
+
+func (h *Handler) ChangePassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		var request models.ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Guessing the current password from a stolen session is limited
+		// like guessing it at login.
+		key := passwordChangeKeyPrefix + strconv.FormatInt(UserID, 10)
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		if remaining := h.lockedFor(ctx, key); remaining > 0 {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "password_change_rejected_locked", "user_id", UserID, "ip", clientIP(r))
+			w.Header().Set("Retry-After", retryAfter(remaining))
+			http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+			return
+		}
+
+		dbUser, err := h.user.GetUserByID(ctx, UserID)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+
+		if err := h.auth.VerifyPassword(dbUser.Password, request.CurrentPassword); err != nil {
+			logger.Log.WarnContext(r.Context(), "Security event", "event", "password_change_failed", "user_id", UserID, "ip", clientIP(r))
+			h.registerLoginFailure(ctx, key, h.lockout.Load().login)
+			http.Error(w, "Invalid current password", http.StatusForbidden)
+			return
+		}
+		h.resetLoginFailures(ctx, key)
+
+		if err := h.passwordPolicy.Validate(dbUser.Username, request.NewPassword); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		hashedPassword, err := h.auth.HashPassword(request.NewPassword)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		tokenVersion, err := h.user.UpdatePassword(ctx, UserID, hashedPassword)
+		if err != nil {
+			storageError(w, err)
+			return
+		}
+
+		logger.Log.InfoContext(r.Context(), "Security event", "event", "password_changed", "user_id", UserID, "ip", clientIP(r))
+		h.audit(r, models.AuditPasswordChanged, UserID, nil)
+
+		h.setSessionCookie(w, UserID, tokenVersion)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Password changed successfully"))
+	}
+}
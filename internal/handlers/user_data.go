@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+// queueJob returns the user's unfinished job of the given kind, or queues a
+// new one.
+func (h *Handler) queueJob(ctx context.Context, userID int64, kind string) (*models.Job, bool, error) {
+	latest, err := h.jobs.GetLatestJob(ctx, userID, kind)
+	if err == nil && !latest.Finished() {
+		return latest, false, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, false, err
+	}
+
+	job := &models.Job{
+		ID:     randomString(),
+		UserID: userID,
+		Kind:   kind,
+		Status: models.JobStatusPending,
+	}
+	if err := h.jobs.CreateJob(ctx, job); err != nil {
+		return nil, false, err
+	}
+	return job, true, nil
+}
+
+func writeJobAccepted(w http.ResponseWriter, job *models.Job) {
+	w.Header().Set("Location", "/api/user/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ExportUserData queues an export of the user's data and answers 202 with the
+// job to poll. While an export is still unfinished that job is returned
+// instead; the archive is served by GetJobResult.
+func (h *Handler) ExportUserData() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		job, created, err := h.queueJob(ctx, UserID, models.JobKindExport)
+		if err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to queue export", "error", err)
+			storageError(w, err)
+			return
+		}
+		if created {
+			h.audit(r, models.AuditExportRequested, UserID, map[string]string{"job_id": job.ID})
+		}
+
+		writeJobAccepted(w, job)
+	}
+}
+
+// DeleteUser queues the anonymisation of the account. Sessions and API keys
+// stop working once the job has run.
+func (h *Handler) DeleteUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		job, created, err := h.queueJob(ctx, UserID, models.JobKindDelete)
+		if err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to queue account deletion", "error", err)
+			storageError(w, err)
+			return
+		}
+		if created {
+			logger.Log.InfoContext(r.Context(), "Security event", "event", "deletion_requested", "user_id", UserID)
+			h.audit(r, models.AuditDeletionRequested, UserID, map[string]string{"job_id": job.ID})
+		}
+
+		writeJobAccepted(w, job)
+	}
+}
+
+// GetJob reports the status of a job. It needs no session: a deleted user
+// has none left, and the random job ID already limits who can ask.
+func (h *Handler) GetJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		job, err := h.jobs.GetJob(ctx, chi.URLParam(r, "id"))
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, "Job not found", http.StatusNotFound)
+				return
+			}
+			logger.Log.ErrorContext(r.Context(), "Failed to get job", "error", err)
+			storageError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// GetJobResult serves the archive of a finished export. Unlike GetJob it
+// needs the session of the job's owner.
+func (h *Handler) GetJobResult() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		UserID, ok := r.Context().Value(constants.UserIDKey).(int64)
+		if !ok {
+			http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := h.dbContext(r)
+		defer cancel()
+
+		job, err := h.jobs.GetJob(ctx, chi.URLParam(r, "id"))
+		if err == nil && job.UserID != UserID {
+			err = storage.ErrNotFound
+		}
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, "Job not found", http.StatusNotFound)
+				return
+			}
+			logger.Log.ErrorContext(r.Context(), "Failed to get job", "error", err)
+			storageError(w, err)
+			return
+		}
+
+		if job.Kind != models.JobKindExport || job.Status != models.JobStatusDone {
+			http.Error(w, "Job has no result", http.StatusConflict)
+			return
+		}
+
+		archive, err := h.jobs.GetJobResult(ctx, job.ID)
+		if err != nil {
+			logger.Log.ErrorContext(r.Context(), "Failed to get export archive", "error", err)
+			storageError(w, err)
+			return
+		}
+		if archive == nil {
+			http.Error(w, "Export is no longer available", http.StatusGone)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="gophermart-export.zip"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(archive)
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/learies/gofermart/internal/services"
+)
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	// alice is stored with a bcrypt hash; the handler now hashes with argon2id.
+	h, store := newLockoutTestHandler(t, lockoutPolicy(100), lockoutPolicy(100))
+	h.auth = services.NewAuthService(services.HashOptions{
+		Algorithm: services.HashAlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1,
+	})
+	ctx := context.Background()
+
+	storedHash := func() string {
+		t.Helper()
+		user, err := store.Users.GetUserByUsername(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.Password
+	}
+	legacy := storedHash()
+
+	if rec := passwordLogin(h, "192.0.2.1", "alice", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password status = %d: %s", rec.Code, rec.Body)
+	}
+	if storedHash() != legacy {
+		t.Fatal("a failed login rehashed the password")
+	}
+
+	if rec := passwordLogin(h, "192.0.2.1", "alice", lockoutTestPassword); rec.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", rec.Code, rec.Body)
+	}
+	upgraded := storedHash()
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("stored hash = %q, want it upgraded to argon2id", upgraded)
+	}
+
+	if rec := passwordLogin(h, "192.0.2.1", "alice", lockoutTestPassword); rec.Code != http.StatusOK {
+		t.Fatalf("login with the upgraded hash status = %d: %s", rec.Code, rec.Body)
+	}
+	if storedHash() != upgraded {
+		t.Error("a current hash was rehashed again")
+	}
+}
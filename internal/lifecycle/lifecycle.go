@@ -0,0 +1,120 @@
+// Package lifecycle starts the components of the service in order and stops
+// them in reverse.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/learies/gofermart/internal/config/logger"
+)
+
+// Hook is a component of the service. OnStart must not block; a hook without
+// OnStart describes a resource that is already acquired, and is stopped
+// whether or not Start was called.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+type Lifecycle struct {
+	mu      sync.Mutex
+	pending []Hook
+	started []Hook
+}
+
+func New() *Lifecycle {
+	return &Lifecycle{}
+}
+
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if hook.OnStart == nil {
+		l.started = append(l.started, hook)
+		return
+	}
+	l.pending = append(l.pending, hook)
+}
+
+// Go adds a background worker. It runs until the lifecycle is stopped, not
+// until the context given to Start is cancelled, so that workers outlive the
+// draining of the HTTP server.
+func (l *Lifecycle) Go(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	l.Append(Hook{
+		Name: name,
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				run(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+}
+
+// Start runs the pending hooks in the order they were added. If one fails,
+// the hooks started so far are stopped and the error is returned.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for _, hook := range pending {
+		if err := hook.OnStart(ctx); err != nil {
+			if stopErr := l.Stop(context.WithoutCancel(ctx)); stopErr != nil {
+				logger.Log.Error("Failed to stop after a failed start", "error", stopErr)
+			}
+			return fmt.Errorf("start %s: %w", hook.Name, err)
+		}
+		logger.Log.Info("Started", "component", hook.Name)
+
+		l.mu.Lock()
+		l.started = append(l.started, hook)
+		l.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Stop stops the started hooks in reverse order. Every hook is stopped even
+// if an earlier one fails or ctx expires; the errors are joined.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	started := l.started
+	l.started = nil
+	l.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+		if hook.OnStop == nil {
+			continue
+		}
+		if err := hook.OnStop(ctx); err != nil {
+			logger.Log.Error("Failed to stop", "component", hook.Name, "error", err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", hook.Name, err))
+			continue
+		}
+		logger.Log.Info("Stopped", "component", hook.Name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,207 @@
+// Package metrics exposes the metrics of the service in the Prometheus
+// format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/learies/gofermart/internal/config/logger"
+)
+
+const scrapeTimeout = 5 * time.Second
+
+// Registry holds the metrics of the service, along with those of the Go
+// runtime and the process.
+var Registry = prometheus.NewRegistry()
+
+// Outcomes of a call to the accrual system.
+const (
+	AccrualOK              = "200"
+	AccrualNoContent       = "204"
+	AccrualTooManyRequests = "429"
+	AccrualError           = "error"
+)
+
+var factory = promauto.With(Registry)
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gophermart_http_requests_total",
+		Help: "HTTP requests by route pattern and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gophermart_http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	AccrualRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gophermart_accrual_requests_total",
+		Help: "Calls to the accrual system by outcome.",
+	}, []string{"outcome"})
+	AccrualRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gophermart_accrual_request_duration_seconds",
+		Help:    "Latency of calls to the accrual system by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"outcome"})
+
+	UsersRegistered = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "gophermart_users_registered_total",
+		Help: "Registered users by registration method.",
+	}, []string{"method"})
+	OrdersUploaded = factory.NewCounter(prometheus.CounterOpts{
+		Name: "gophermart_orders_uploaded_total",
+		Help: "Orders uploaded by users.",
+	})
+	PointsAccrued = factory.NewCounter(prometheus.CounterOpts{
+		Name: "gophermart_points_accrued_total",
+		Help: "Loyalty points accrued to users.",
+	})
+	PointsWithdrawn = factory.NewCounter(prometheus.CounterOpts{
+		Name: "gophermart_points_withdrawn_total",
+		Help: "Loyalty points withdrawn by users.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		poolCollector{},
+		pendingOrdersCollector{},
+	)
+}
+
+// Handler serves every registered metric. A metric that fails to collect is
+// left out of the scrape and logged.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		ErrorLog:      errorLog{},
+		ErrorHandling: promhttp.ContinueOnError,
+		Timeout:       scrapeTimeout,
+	})
+}
+
+type errorLog struct{}
+
+func (errorLog) Println(v ...any) {
+	logger.Log.Warn("Failed to collect metrics", "error", fmt.Sprint(v...))
+}
+
+// PoolStats is a snapshot of a database connection pool.
+type PoolStats struct {
+	AcquiredConns        int32
+	IdleConns            int32
+	TotalConns           int32
+	MaxConns             int32
+	AcquireCount         int64
+	AcquireDuration      time.Duration
+	EmptyAcquireCount    int64
+	CanceledAcquireCount int64
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = map[string]func() PoolStats{}
+)
+
+// RegisterDBPool adds the pool to the gophermart_db_pool_* metrics under the
+// given name.
+func RegisterDBPool(name string, stats func() PoolStats) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	pools[name] = stats
+}
+
+func poolDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, []string{"pool"}, nil)
+}
+
+var poolMetrics = []struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(PoolStats) float64
+}{
+	{poolDesc("gophermart_db_pool_acquired_conns", "Connections currently in use."), prometheus.GaugeValue,
+		func(s PoolStats) float64 { return float64(s.AcquiredConns) }},
+	{poolDesc("gophermart_db_pool_idle_conns", "Idle connections."), prometheus.GaugeValue,
+		func(s PoolStats) float64 { return float64(s.IdleConns) }},
+	{poolDesc("gophermart_db_pool_total_conns", "Open connections."), prometheus.GaugeValue,
+		func(s PoolStats) float64 { return float64(s.TotalConns) }},
+	{poolDesc("gophermart_db_pool_max_conns", "Maximum size of the pool."), prometheus.GaugeValue,
+		func(s PoolStats) float64 { return float64(s.MaxConns) }},
+	{poolDesc("gophermart_db_pool_acquires_total", "Connections acquired from the pool."), prometheus.CounterValue,
+		func(s PoolStats) float64 { return float64(s.AcquireCount) }},
+	{poolDesc("gophermart_db_pool_acquire_seconds_total", "Time spent waiting for connections."), prometheus.CounterValue,
+		func(s PoolStats) float64 { return s.AcquireDuration.Seconds() }},
+	{poolDesc("gophermart_db_pool_empty_acquires_total", "Acquires that had to wait for a connection."), prometheus.CounterValue,
+		func(s PoolStats) float64 { return float64(s.EmptyAcquireCount) }},
+	{poolDesc("gophermart_db_pool_canceled_acquires_total", "Acquires cancelled before a connection was available."), prometheus.CounterValue,
+		func(s PoolStats) float64 { return float64(s.CanceledAcquireCount) }},
+}
+
+// poolCollector reads the registered pools at scrape time.
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range poolMetrics {
+		ch <- m.desc
+	}
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	for name, stats := range pools {
+		snapshot := stats()
+		for _, m := range poolMetrics {
+			ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value(snapshot), name)
+		}
+	}
+}
+
+var (
+	pendingOrdersDesc = prometheus.NewDesc("gophermart_orders_pending",
+		"Orders waiting for a final accrual status.", nil, nil)
+	pendingOrders atomic.Pointer[func(ctx context.Context) (int64, error)]
+)
+
+// RegisterPendingOrders exposes the number of orders whose accrual is not
+// final yet, counted by count at scrape time.
+func RegisterPendingOrders(count func(ctx context.Context) (int64, error)) {
+	pendingOrders.Store(&count)
+}
+
+type pendingOrdersCollector struct{}
+
+func (pendingOrdersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pendingOrdersDesc
+}
+
+func (pendingOrdersCollector) Collect(ch chan<- prometheus.Metric) {
+	count := pendingOrders.Load()
+	if count == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	n, err := (*count)(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(pendingOrdersDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(pendingOrdersDesc, prometheus.GaugeValue, float64(n))
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+// RequireAdmin lets through only authenticated users flagged as admins.
+func RequireAdmin(users storage.UserStorage, dbTimeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(constants.UserIDKey).(int64)
+			if !ok {
+				http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), dbTimeout)
+			isAdmin, err := users.IsAdmin(ctx, userID)
+			cancel()
+			if err != nil {
+				logger.Log.ErrorContext(r.Context(), "Failed to check admin flag", "user_id", userID, "error", err)
+				storageError(w, err)
+				return
+			}
+			if !isAdmin {
+				logger.Log.WarnContext(r.Context(), "Security event", "event", "admin_access_denied", "user_id", userID)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,35 +2,143 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/learies/gofermart/internal/config/logger"
 	"github.com/learies/gofermart/internal/constants"
 	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
 )
 
-var jwtService = services.NewJWTService()
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && services.IsAPIKey(token) {
+		return token
+	}
+	return ""
+}
 
-func JWTMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var tokenString string
+func storageError(w http.ResponseWriter, err error) {
+	if storage.IsUnavailable(err) {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
 
-		cookie, err := r.Cookie("token")
-		if err == nil {
-			tokenString = cookie.Value
-		}
+// JWTMiddleware authenticates the request by API key or session cookie.
+// Every storage lookup it makes is bounded by dbTimeout.
+func JWTMiddleware(jwtService services.JWTService, users storage.UserStorage, apiKeys storage.APIKeyStorage, dbTimeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := apiKeyFromRequest(r); key != "" {
+				dbCtx, cancel := context.WithTimeout(r.Context(), dbTimeout)
+				defer cancel()
+
+				apiKey, err := apiKeys.GetAPIKeyByHash(dbCtx, services.HashAPIKey(key))
+				if err != nil {
+					if errors.Is(err, storage.ErrNotFound) {
+						logger.Log.WarnContext(r.Context(), "Invalid API key")
+						http.Error(w, "Forbidden", http.StatusForbidden)
+						return
+					}
+					logger.Log.ErrorContext(r.Context(), "Failed to get API key", "error", err)
+					storageError(w, err)
+					return
+				}
+
+				now := time.Now()
+				if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(now) {
+					logger.Log.WarnContext(r.Context(), "Expired API key", "key_id", apiKey.ID, "user_id", apiKey.UserID)
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
 
-		if tokenString != "" {
-			userID, err := jwtService.VerifyToken(tokenString)
-			if err != nil {
-				logger.Log.Warn("Invalid token", "error", err)
-				http.Error(w, "Forbidden", http.StatusForbidden)
+				if err := apiKeys.TouchAPIKey(dbCtx, apiKey.ID, now); err != nil {
+					logger.Log.ErrorContext(r.Context(), "Failed to update API key usage", "error", err)
+				}
+
+				logger.AddAttrs(r.Context(), slog.Int64("user_id", apiKey.UserID), slog.Int64("api_key_id", apiKey.ID))
+				ctx := context.WithValue(r.Context(), constants.UserIDKey, apiKey.UserID)
+				ctx = context.WithValue(ctx, constants.APIKeyScopesKey, apiKey.Scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
-			ctx := context.WithValue(r.Context(), constants.UserIDKey, userID)
-			r = r.WithContext(ctx)
-		}
 
+			var tokenString string
+
+			cookie, err := r.Cookie("token")
+			if err == nil {
+				tokenString = cookie.Value
+			}
+
+			if tokenString != "" {
+				claims, err := jwtService.VerifyToken(tokenString)
+				if err != nil {
+					logger.Log.WarnContext(r.Context(), "Invalid token", "error", err)
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+
+				dbCtx, cancel := context.WithTimeout(r.Context(), dbTimeout)
+				version, err := users.GetTokenVersion(dbCtx, claims.UserID)
+				cancel()
+				if errors.Is(err, storage.ErrNotFound) {
+					logger.Log.WarnContext(r.Context(), "Token for unknown user", "user_id", claims.UserID)
+					http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					logger.Log.ErrorContext(r.Context(), "Failed to get token version", "error", err)
+					storageError(w, err)
+					return
+				}
+				if version != claims.TokenVersion {
+					logger.Log.WarnContext(r.Context(), "Revoked token", "user_id", claims.UserID)
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+
+				logger.AddAttrs(r.Context(), slog.Int64("user_id", claims.UserID))
+				ctx := context.WithValue(r.Context(), constants.UserIDKey, claims.UserID)
+				r = r.WithContext(ctx)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope rejects requests authenticated with an API key that has none
+// of scopes. Cookie sessions pass through.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted, ok := r.Context().Value(constants.APIKeyScopesKey).([]string)
+			if ok && !slices.ContainsFunc(scopes, func(scope string) bool { return slices.Contains(granted, scope) }) {
+				http.Error(w, "API key lacks scope "+strings.Join(scopes, " or "), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects requests authenticated with an API key, for account
+// management endpoints that must only be reachable from a login session.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(constants.APIKeyScopesKey).([]string); ok {
+			http.Error(w, "API keys cannot be used here", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
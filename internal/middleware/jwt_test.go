@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+	"github.com/learies/gofermart/internal/storage/memory"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.NewLogger(logger.Options{Level: "error", Format: "text", Output: "stderr"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type authFixture struct {
+	store *storage.Storage
+	jwt   services.JWTService
+}
+
+func newAuthFixture() *authFixture {
+	return &authFixture{
+		store: memory.New(services.NewAuthService(services.HashOptions{BcryptCost: 4})),
+		jwt:   services.NewJWTService("test-jwt-secret-0123456789abcdef0123"),
+	}
+}
+
+func (f *authFixture) user(t *testing.T, login string) int64 {
+	t.Helper()
+	userID, err := f.store.Users.CreateUser(context.Background(), login, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func (f *authFixture) apiKey(t *testing.T, userID int64, expiresAt *time.Time, scopes ...string) string {
+	t.Helper()
+	key, prefix, err := services.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey := &models.APIKey{UserID: userID, Name: "test", Prefix: prefix, Scopes: scopes, ExpiresAt: expiresAt}
+	if err := f.store.APIKeys.CreateAPIKey(context.Background(), apiKey, services.HashAPIKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (f *authFixture) session(userID int64, tokenVersion int) *http.Cookie {
+	return &http.Cookie{Name: "token", Value: f.jwt.GenerateToken(userID, tokenVersion, time.Now().Add(time.Hour))}
+}
+
+// serve passes req through JWTMiddleware and then guards to a handler that
+// answers with the authenticated user ID.
+func (f *authFixture) serve(req *http.Request, guards ...func(http.Handler) http.Handler) *httptest.ResponseRecorder {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(constants.UserIDKey).(int64)
+		w.Write([]byte(strconv.FormatInt(userID, 10)))
+	})
+	for i := len(guards) - 1; i >= 0; i-- {
+		handler = guards[i](handler)
+	}
+	handler = JWTMiddleware(f.jwt, f.store.Users, f.store.APIKeys, time.Second)(handler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	f := newAuthFixture()
+	alice, bob := f.user(t, "alice"), f.user(t, "bob")
+	aliceKey := f.apiKey(t, alice, nil, models.ScopeBalanceRead)
+	expired := time.Now().Add(-time.Minute)
+	expiredKey := f.apiKey(t, alice, &expired, models.ScopeBalanceRead)
+
+	revoked := f.session(bob, 0)
+	if _, err := f.store.Users.UpdatePassword(context.Background(), bob, "new-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		prepare    func(r *http.Request)
+		wantStatus int
+		wantUser   int64
+	}{
+		{name: "anonymous", wantStatus: http.StatusOK},
+		{
+			name:       "session cookie",
+			prepare:    func(r *http.Request) { r.AddCookie(f.session(alice, 0)) },
+			wantStatus: http.StatusOK,
+			wantUser:   alice,
+		},
+		{
+			name:       "revoked session",
+			prepare:    func(r *http.Request) { r.AddCookie(revoked) },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "API key header",
+			prepare:    func(r *http.Request) { r.Header.Set("X-API-Key", aliceKey) },
+			wantStatus: http.StatusOK,
+			wantUser:   alice,
+		},
+		{
+			name:       "API key bearer token",
+			prepare:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+aliceKey) },
+			wantStatus: http.StatusOK,
+			wantUser:   alice,
+		},
+		{
+			name: "API key takes precedence over the cookie",
+			prepare: func(r *http.Request) {
+				r.Header.Set("X-API-Key", aliceKey)
+				r.AddCookie(f.session(bob, 1))
+			},
+			wantStatus: http.StatusOK,
+			wantUser:   alice,
+		},
+		{
+			name: "unknown API key is not excused by a cookie",
+			prepare: func(r *http.Request) {
+				r.Header.Set("X-API-Key", services.APIKeyPrefix+"unknown")
+				r.AddCookie(f.session(alice, 0))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "expired API key",
+			prepare:    func(r *http.Request) { r.Header.Set("X-API-Key", expiredKey) },
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+			if tt.prepare != nil {
+				tt.prepare(req)
+			}
+			rec := f.serve(req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != strconv.FormatInt(tt.wantUser, 10) {
+				t.Errorf("user = %s, want %d", rec.Body, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestRequireScopeAndSession(t *testing.T) {
+	f := newAuthFixture()
+	alice := f.user(t, "alice")
+	readKey := f.apiKey(t, alice, nil, models.ScopeOrdersRead)
+	writeKey := f.apiKey(t, alice, nil, models.ScopeOrdersWrite)
+	balanceKey := f.apiKey(t, alice, nil, models.ScopeBalanceRead, models.ScopeWithdraw)
+	listOrders := RequireScope(models.ScopeOrdersRead, models.ScopeOrdersWrite)
+	uploadOrder := RequireScope(models.ScopeOrdersWrite)
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		guard      func(http.Handler) http.Handler
+		wantStatus int
+	}{
+		{name: "read key lists orders", apiKey: readKey, guard: listOrders, wantStatus: http.StatusOK},
+		{name: "write key lists orders", apiKey: writeKey, guard: listOrders, wantStatus: http.StatusOK},
+		{name: "balance key lists orders", apiKey: balanceKey, guard: listOrders, wantStatus: http.StatusForbidden},
+		{name: "read key uploads an order", apiKey: readKey, guard: uploadOrder, wantStatus: http.StatusForbidden},
+		{name: "write key uploads an order", apiKey: writeKey, guard: uploadOrder, wantStatus: http.StatusOK},
+		{name: "session uploads an order", guard: uploadOrder, wantStatus: http.StatusOK},
+		{name: "key changes the password", apiKey: writeKey, guard: RequireSession, wantStatus: http.StatusForbidden},
+		{name: "session changes the password", guard: RequireSession, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			} else {
+				req.AddCookie(f.session(alice, 0))
+			}
+			if rec := f.serve(req, tt.guard); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
@@ -70,7 +70,7 @@ func WithLogging(next http.Handler) http.Handler {
 
 		duration := time.Since(start)
 
-		logger.Log.Info("Request completed",
+		logger.Log.InfoContext(r.Context(), "Request completed",
 			"uri", r.RequestURI,
 			"method", r.Method,
 			"status", responseData.status,
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/learies/gofermart/internal/metrics"
+)
+
+// WithMetrics counts requests and their latency by route pattern.
+func WithMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		responseData := &responseData{}
+		lw := &loggingResponseWriter{
+			ResponseWriter: w,
+			responseData:   responseData,
+		}
+
+		next.ServeHTTP(lw, r)
+
+		route := routePattern(r)
+		status := responseData.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := []string{r.Method, route, strconv.Itoa(status)}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
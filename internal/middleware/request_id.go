@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/constants"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+
+	unmatchedRoute = "unmatched"
+)
+
+// validRequestID accepts the IDs that proxies commonly generate, and nothing
+// that could forge log fields or response headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// routeValue resolves the route pattern when a record is logged rather than
+// when the request comes in, since chi matches it only further down.
+type routeValue struct {
+	r *http.Request
+}
+
+func (v routeValue) LogValue() slog.Value {
+	return slog.StringValue(routePattern(v.r))
+}
+
+// routePattern returns the pattern of the route that handled r, so that e.g.
+// every /api/user/orders/{number} request shares it.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return unmatchedRoute
+}
+
+// RequestID tags the request with the ID from the X-Request-ID header, or a
+// new one, and echoes it in the response. Records logged with the request
+// context carry the ID and the route.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request.id", id))
+
+		ctx := context.WithValue(r.Context(), constants.RequestIDKey, id)
+		ctx = logger.NewContext(ctx,
+			slog.String("request_id", id),
+			slog.Any("route", routeValue{r}),
+		)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeBalanceRead = "balance:read"
+	ScopeWithdraw    = "withdraw"
+)
+
+var APIKeyScopes = []string{ScopeOrdersRead, ScopeOrdersWrite, ScopeBalanceRead, ScopeWithdraw}
+
+type APIKey struct {
+	ID         int64      `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"-"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	Scopes     []string   `db:"scopes" json:"scopes"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Audit event types.
+const (
+	AuditUserRegistered    = "user_registered"
+	AuditLoginSucceeded    = "login_succeeded"
+	AuditLoginFailed       = "login_failed"
+	AuditPasswordChanged   = "password_changed"
+	AuditWithdrawal        = "withdrawal"
+	AuditTOTPEnabled       = "totp_enabled"
+	AuditTOTPDisabled      = "totp_disabled"
+	AuditAPIKeyCreated     = "api_key_created"
+	AuditAPIKeyRevoked     = "api_key_revoked"
+	AuditAdminAuditViewed  = "admin_audit_viewed"
+	AuditExportRequested   = "export_requested"
+	AuditDeletionRequested = "deletion_requested"
+	AuditAccountDeleted    = "account_deleted"
+	AuditLogLevelChanged   = "log_level_changed"
+	AuditAdminGranted      = "admin_granted"
+	AuditAdminRevoked      = "admin_revoked"
+)
+
+type AuditEvent struct {
+	ID        int64             `json:"id"`
+	Type      string            `json:"type"`
+	UserID    int64             `json:"user_id,omitempty"`
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	RequestID string            `json:"request_id,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// AuditQuery selects audit events, newest first. Zero values mean no filter.
+type AuditQuery struct {
+	UserID   int64
+	Type     string
+	From     time.Time
+	To       time.Time
+	BeforeID int64
+	Limit    int
+}
@@ -0,0 +1,22 @@
+package models
+
+// Statuses of a health check and of the service as a whole.
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+	HealthDown        = "down"
+)
+
+type HealthCheck struct {
+	Name          string  `json:"name"`
+	Status        string  `json:"status"`
+	LatencyMS     float64 `json:"latency_ms"`
+	SchemaVersion int64   `json:"schema_version,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
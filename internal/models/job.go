@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Kinds of a user job.
+const (
+	JobKindExport = "export"
+	JobKindDelete = "delete"
+)
+
+// Statuses of a user job.
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+// Job is a long-running operation on a user's data. The result of an export
+// is the ZIP archive.
+type Job struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"-"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Result     []byte     `json:"-"`
+}
+
+// Finished reports whether the job has stopped running.
+func (j *Job) Finished() bool {
+	return j.Status == JobStatusDone || j.Status == JobStatusFailed
+}
+
+// LedgerEntry is a single movement of a user's balance.
+type LedgerEntry struct {
+	OrderNumber string    `json:"order"`
+	Type        string    `json:"type"`
+	Amount      float32   `json:"amount"`
+	At          time.Time `json:"at"`
+}
+
+// Types of a ledger entry.
+const (
+	LedgerAccrual    = "accrual"
+	LedgerWithdrawal = "withdrawal"
+)
+
+// UserProfile is the account data included in an export.
+type UserProfile struct {
+	ID               int64    `json:"id"`
+	Login            string   `json:"login"`
+	TwoFactorEnabled bool     `json:"two_factor_enabled"`
+	APIKeys          []APIKey `json:"api_keys"`
+}
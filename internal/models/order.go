@@ -17,3 +17,37 @@ type OrderResponse struct {
 	Withdrawn  float32   `json:"sum,omitempty"`
 	UploadedAt time.Time `json:"uploaded_at"`
 }
+
+// Sources of an order event.
+const (
+	OrderEventSourceUpload      = "user_upload"
+	OrderEventSourceAccrualPoll = "accrual_poll"
+)
+
+type OrderEvent struct {
+	Status    string    `json:"status"`
+	Accrual   float32   `json:"accrual,omitempty"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrderTimeline struct {
+	OrderResponse
+	Events []OrderEvent `json:"events"`
+}
+
+// OrderCursor points at the last order of a page.
+type OrderCursor struct {
+	UploadedAt time.Time `json:"t"`
+	OrderID    string    `json:"id"`
+}
+
+// OrderQuery selects a page of a user's orders. Zero values mean no filter.
+type OrderQuery struct {
+	Statuses  []string
+	From      time.Time
+	To        time.Time
+	Ascending bool
+	After     *OrderCursor
+	Limit     int
+}
@@ -0,0 +1,28 @@
+package models
+
+type TOTP struct {
+	UserID   int64  `db:"user_id"`
+	Secret   string `db:"secret"`
+	Enabled  bool   `db:"enabled"`
+	LastStep int64  `db:"last_step"`
+}
+
+type TOTPEnrolment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type LoginChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
+}
+
+type TwoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
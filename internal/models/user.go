@@ -1,7 +1,13 @@
 package models
 
 type User struct {
-	ID       int64  `db:"id" json:"id" `
-	Username string `db:"login" json:"login"`
-	Password string `db:"password" json:"password"`
+	ID           int64  `db:"id" json:"id" `
+	Username     string `db:"login" json:"login"`
+	Password     string `db:"password" json:"password"`
+	TokenVersion int    `db:"token_version" json:"-"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
@@ -1,47 +1,186 @@
 package routes
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/learies/gofermart/internal/config"
 	"github.com/learies/gofermart/internal/config/logger"
 	"github.com/learies/gofermart/internal/handlers"
+	"github.com/learies/gofermart/internal/lifecycle"
+	"github.com/learies/gofermart/internal/metrics"
 	internalMiddleware "github.com/learies/gofermart/internal/middleware"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+	"github.com/learies/gofermart/internal/storage/memory"
 	"github.com/learies/gofermart/internal/storage/postgres"
+	"github.com/learies/gofermart/internal/storage/sqlite"
+	"github.com/learies/gofermart/internal/worker"
 )
 
 type Router struct {
 	*chi.Mux
+
+	reloaders []func(cfg *config.Config)
+}
+
+// ApplyConfig passes the reloadable settings of cfg to the components built
+// by Initialize.
+func (r *Router) ApplyConfig(cfg *config.Config) {
+	for _, apply := range r.reloaders {
+		apply(cfg)
+	}
 }
 
 func NewRouter() *Router {
 	return &Router{Mux: chi.NewRouter()}
 }
 
-func (r *Router) Initialize(cfg *config.Config) error {
+// Initialize opens the storage and builds the routes. Connections to close
+// and workers to run are registered with lc.
+func (r *Router) Initialize(cfg *config.Config, lc *lifecycle.Lifecycle) error {
+
+	auth := services.NewAuthService(services.HashOptions{
+		Algorithm:     cfg.PasswordHashAlgorithm,
+		BcryptCost:    cfg.BcryptCost,
+		Argon2Time:    uint32(cfg.Argon2Time),
+		Argon2Memory:  uint32(cfg.Argon2Memory),
+		Argon2Threads: uint8(cfg.Argon2Threads),
+	})
+
+	var store *storage.Storage
+	switch {
+	case cfg.StorageBackend == "memory":
+		logger.Log.Warn("Using in-memory storage, data will be lost on restart")
+		store = memory.New(auth)
+	case cfg.StorageBackend != "":
+		return fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	case sqlite.IsDSN(cfg.DatabaseURI):
+		db, err := sqlite.Open(context.Background(), cfg.DatabaseURI, cfg.MigrateOnStart)
+		if err != nil {
+			return fmt.Errorf("unable to set up database: %w", err)
+		}
+		lc.Append(lifecycle.Hook{Name: "sqlite", OnStop: func(context.Context) error {
+			return db.Close()
+		}})
+		store = sqlite.New(db, auth)
+	default:
+		poolConfig := postgres.PoolConfig{
+			DSN:               cfg.DatabaseURI,
+			MaxConns:          cfg.DBMaxConns,
+			MinConns:          cfg.DBMinConns,
+			MaxConnLifetime:   cfg.DBMaxConnLifetime,
+			MaxConnIdleTime:   cfg.DBMaxConnIdleTime,
+			HealthCheckPeriod: cfg.DBHealthCheckPeriod,
+			StartupTimeout:    cfg.DBStartupTimeout,
+		}
+
+		dbPool, err := postgres.SetupDB(poolConfig, cfg.MigrateOnStart)
+		if err != nil {
+			return fmt.Errorf("unable to set up database: %w", err)
+		}
+		lc.Append(lifecycle.Hook{Name: "postgres", OnStop: func(context.Context) error {
+			postgres.CloseDB(dbPool)
+			return nil
+		}})
+		metrics.RegisterDBPool("primary", func() metrics.PoolStats { return postgres.PoolStats(dbPool) })
+
+		var replica *pgxpool.Pool
+		if cfg.DatabaseReplicaURI != "" {
+			poolConfig.DSN = cfg.DatabaseReplicaURI
+			replica, err = postgres.OpenReplica(poolConfig)
+			if err != nil {
+				return fmt.Errorf("unable to set up read replica: %w", err)
+			}
+			lc.Append(lifecycle.Hook{Name: "postgres replica", OnStop: func(context.Context) error {
+				postgres.CloseDB(replica)
+				return nil
+			}})
+			metrics.RegisterDBPool("replica", func() metrics.PoolStats { return postgres.PoolStats(replica) })
+		}
+
+		store = storage.NewPostgres(dbPool, replica, auth)
+	}
+
+	metrics.RegisterPendingOrders(store.Orders.CountPendingOrders)
 
-	dbPool, err := postgres.SetupDB()
+	if cfg.AccrualPollInterval > 0 {
+		poller := worker.NewAccrualPoller(store.Orders, cfg.AccrualSystemAddress, cfg.AccrualPollInterval, cfg.AccrualWorkers)
+		lc.Go("accrual poller", poller.Run)
+		r.reloaders = append(r.reloaders, func(cfg *config.Config) { poller.SetWorkers(cfg.AccrualWorkers) })
+	}
+
+	if cfg.AuditRetention > 0 {
+		lc.Go("audit retention", worker.NewAuditRetention(store.Audit, cfg.AuditRetention).Run)
+	}
+
+	lc.Go("user jobs", worker.NewUserJobs(store).Run)
+
+	userHandlers, err := handlers.NewHandler(store, auth, cfg)
 	if err != nil {
-		logger.Log.Error("Unable to connect to database", "error", err)
+		return err
 	}
+	r.reloaders = append(r.reloaders, userHandlers.ApplyConfig)
 
 	routes := r.Mux
-	routes.Use(internalMiddleware.JWTMiddleware)
-	routes.Use(internalMiddleware.WithLogging)
-
-	userHandlers := handlers.NewHandler(dbPool)
-
-	routes.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", userHandlers.RegisterUser())
-		r.Post("/login", userHandlers.LoginUser())
-		r.Post("/orders", userHandlers.CreateOrder(cfg.AccrualSystemAddress))
-		r.Get("/orders", userHandlers.GetUserOrders())
-		r.Get("/balance", userHandlers.GetUserBalance())
-		r.Post("/balance/withdraw", userHandlers.Withdraw(cfg.AccrualSystemAddress))
-		r.Get("/withdrawals", userHandlers.GetUserWithdrawals())
-		r.MethodNotAllowed(methodNotAllowedHandler)
+
+	// Probes are hit every few seconds and carry no credentials.
+	routes.Get("/healthz", userHandlers.Liveness())
+	routes.Get("/readyz", userHandlers.Readiness())
+
+	routes.Group(func(api chi.Router) {
+		api.Use(internalMiddleware.WithTracing)
+		api.Use(internalMiddleware.RequestID)
+		// Counted before authentication, so that rejected requests show up.
+		api.Use(internalMiddleware.WithMetrics)
+		api.Use(internalMiddleware.JWTMiddleware(services.NewJWTService(cfg.JWTSecret), store.Users, store.APIKeys, cfg.DBTimeout))
+		api.Use(internalMiddleware.WithLogging)
+
+		api.Route("/api/user", func(r chi.Router) {
+			r.Post("/register", userHandlers.RegisterUser())
+			r.Post("/login", userHandlers.LoginUser())
+			r.Post("/login/2fa", userHandlers.LoginTwoFactor())
+			r.Get("/oidc/login", userHandlers.OIDCLogin())
+			r.Get("/oidc/callback", userHandlers.OIDCCallback())
+			r.Get("/jobs/{id}", userHandlers.GetJob())
+
+			r.With(internalMiddleware.RequireScope(models.ScopeOrdersWrite)).Post("/orders", userHandlers.CreateOrder(cfg.AccrualSystemAddress))
+			// Keys issued before orders:read existed read orders with orders:write.
+			r.With(internalMiddleware.RequireScope(models.ScopeOrdersRead, models.ScopeOrdersWrite)).Get("/orders", userHandlers.GetUserOrders())
+			r.With(internalMiddleware.RequireScope(models.ScopeOrdersRead, models.ScopeOrdersWrite)).Get("/orders/{number}", userHandlers.GetUserOrder())
+			r.With(internalMiddleware.RequireScope(models.ScopeBalanceRead)).Get("/balance", userHandlers.GetUserBalance())
+			r.With(internalMiddleware.RequireScope(models.ScopeWithdraw)).Post("/balance/withdraw", userHandlers.Withdraw(cfg.AccrualSystemAddress))
+			r.With(internalMiddleware.RequireScope(models.ScopeBalanceRead)).Get("/withdrawals", userHandlers.GetUserWithdrawals())
+
+			r.Group(func(r chi.Router) {
+				r.Use(internalMiddleware.RequireSession)
+				r.Post("/password", userHandlers.ChangePassword())
+				r.Post("/2fa", userHandlers.EnrollTOTP())
+				r.Post("/2fa/confirm", userHandlers.ConfirmTOTP())
+				r.Delete("/2fa", userHandlers.DisableTOTP())
+				r.Post("/keys", userHandlers.CreateAPIKey())
+				r.Get("/keys", userHandlers.ListAPIKeys())
+				r.Delete("/keys/{id}", userHandlers.RevokeAPIKey())
+				r.Get("/export", userHandlers.ExportUserData())
+				r.Get("/jobs/{id}/result", userHandlers.GetJobResult())
+				r.Delete("/", userHandlers.DeleteUser())
+			})
+
+			r.MethodNotAllowed(methodNotAllowedHandler)
+		})
+
+		api.Route("/api/admin", func(r chi.Router) {
+			r.Use(internalMiddleware.RequireSession)
+			r.Use(internalMiddleware.RequireAdmin(store.Users, cfg.DBTimeout))
+			r.Get("/audit", userHandlers.ListAuditEvents())
+			r.Get("/log-level", userHandlers.GetLogLevel())
+			r.Put("/log-level", userHandlers.SetLogLevel())
+		})
 	})
 
 	return nil
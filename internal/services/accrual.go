@@ -1,14 +1,25 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/metrics"
 	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/tracing"
 )
 
 var ErrorStatusTooManyRequests = errors.New("no more than N requests per minute allowed")
@@ -20,14 +31,14 @@ func NewAccrualService() AccrualService {
 	return AccrualService{}
 }
 
-func (s *AccrualService) FetchOrder(AccrualSystemAddress, orderNumber string) (chan models.Order, chan error) {
+func (s *AccrualService) FetchOrder(ctx context.Context, AccrualSystemAddress, orderNumber string) (chan models.Order, chan error) {
 	orderChan := make(chan models.Order)
 	errChan := make(chan error)
 
 	go func(orderNumber string) {
 		defer close(orderChan)
 		defer close(errChan)
-		newOrder, err := fetchAccrualInfo(AccrualSystemAddress, orderNumber)
+		newOrder, err := fetchAccrualInfo(ctx, AccrualSystemAddress, orderNumber)
 		if err != nil {
 			errChan <- err
 			return
@@ -38,45 +49,148 @@ func (s *AccrualService) FetchOrder(AccrualSystemAddress, orderNumber string) (c
 	return orderChan, errChan
 }
 
-func fetchAccrualInfo(AccrualSystemAddress, orderNumber string) (models.Order, error) {
-	var order models.Order
+// accrualHealthTTL is how long the outcome of a call to the accrual system
+// answers readiness checks. The system limits requests per minute, so Ping
+// only calls it when nothing else has for that long.
+const accrualHealthTTL = 30 * time.Second
+
+// accrualHealth remembers the outcome of the latest call to the accrual
+// system, made by any AccrualService.
+var accrualHealth struct {
+	sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func recordAccrualHealth(err error) {
+	accrualHealth.Lock()
+	defer accrualHealth.Unlock()
+	accrualHealth.checkedAt = time.Now()
+	accrualHealth.err = err
+}
+
+// Ping reports whether the accrual system answered the latest call, asking
+// it about an unknown order if that call is older than accrualHealthTTL.
+// Any response below 500 other than 429 counts: a system that rejects our
+// requests cannot process orders either.
+func (s *AccrualService) Ping(ctx context.Context, AccrualSystemAddress string) error {
+	accrualHealth.Lock()
+	checkedAt, err := accrualHealth.checkedAt, accrualHealth.err
+	accrualHealth.Unlock()
+	if time.Since(checkedAt) < accrualHealthTTL {
+		return err
+	}
+
+	err = probeAccrual(ctx, AccrualSystemAddress)
+	if ctx.Err() == nil {
+		recordAccrualHealth(err)
+	}
+	return err
+}
+
+func probeAccrual(ctx context.Context, AccrualSystemAddress string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, AccrualSystemAddress+"/api/orders/0", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return accrualStatusError(resp.StatusCode)
+}
+
+// accrualStatusError tells whether a status code shows the accrual system is
+// unavailable to us.
+func accrualStatusError(statusCode int) error {
+	if statusCode == http.StatusTooManyRequests {
+		return ErrorStatusTooManyRequests
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status code: %d", statusCode)
+	}
+	return nil
+}
+
+func fetchAccrualInfo(ctx context.Context, AccrualSystemAddress, orderNumber string) (order models.Order, err error) {
+	start := time.Now()
+	outcome := metrics.AccrualError
+	defer func() {
+		metrics.AccrualRequests.WithLabelValues(outcome).Inc()
+		metrics.AccrualRequestDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	}()
 
 	url := fmt.Sprintf("%s/api/orders/%s", AccrualSystemAddress, orderNumber)
-	resp, err := http.Get(url)
+
+	ctx, span := tracing.Tracer().Start(ctx, "GET /api/orders/{number}",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(http.MethodGet),
+			semconv.URLFull(url),
+		),
+	)
+	defer func() {
+		// An order unknown to the accrual system is not a failure of the call.
+		if err != nil && !errors.Is(err, ErrorOrderNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		logger.Log.Error("Failed to fetch order", "error", err)
+		return order, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			recordAccrualHealth(err)
+		}
+		logger.Log.ErrorContext(ctx, "Failed to fetch order", "error", err)
 		return order, fmt.Errorf("failed to fetch order: %w", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	recordAccrualHealth(accrualStatusError(resp.StatusCode))
 
-	logger.Log.Info("Fetched order", "url", url)
+	logger.Log.InfoContext(ctx, "Fetched order", "url", url)
 
 	if resp.StatusCode == http.StatusNoContent {
-		logger.Log.Info("Order not found")
+		outcome = metrics.AccrualNoContent
+		logger.Log.InfoContext(ctx, "Order not found")
 		return order, ErrorOrderNotFound
 	}
 
 	if resp.StatusCode == http.StatusTooManyRequests {
-		logger.Log.Info("No more than N requests per minute allowed")
+		outcome = metrics.AccrualTooManyRequests
+		logger.Log.InfoContext(ctx, "No more than N requests per minute allowed")
 		return order, ErrorStatusTooManyRequests
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		logger.Log.Error("Unexpected status code", "status", resp.StatusCode)
+		logger.Log.ErrorContext(ctx, "Unexpected status code", "status", resp.StatusCode)
 		return order, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Log.Error("Failed to read response body", "error", err)
+		logger.Log.ErrorContext(ctx, "Failed to read response body", "error", err)
 		return order, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	if err := json.Unmarshal(body, &order); err != nil {
-		logger.Log.Error("Failed to unmarshal order", "error", err)
+		logger.Log.ErrorContext(ctx, "Failed to unmarshal order", "error", err)
 		return order, fmt.Errorf("failed to unmarshal order: %w", err)
 	}
 
-	logger.Log.Info("Unmarshaled order", "order", order)
+	outcome = metrics.AccrualOK
+	logger.Log.InfoContext(ctx, "Unmarshaled order", "order", order)
 	return order, nil
 }
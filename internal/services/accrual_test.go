@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAccrualPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr error
+	}{
+		{name: "unknown order", status: http.StatusNoContent},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: ErrorStatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			accrualHealth.checkedAt, accrualHealth.err = time.Time{}, nil
+
+			accrual := NewAccrualService()
+			for i := 0; i < 3; i++ {
+				if err := accrual.Ping(context.Background(), server.URL); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Ping %d: error = %v, want %v", i, err, tt.wantErr)
+				}
+			}
+			if n := requests.Load(); n != 1 {
+				t.Errorf("accrual system got %d requests, want 1 within the TTL", n)
+			}
+		})
+	}
+}
+
+func TestAccrualPingUsesRecentCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+	}))
+	defer server.Close()
+
+	recordAccrualHealth(accrualStatusError(http.StatusBadGateway))
+	accrual := NewAccrualService()
+	if err := accrual.Ping(context.Background(), server.URL); err == nil {
+		t.Error("Ping after a failed call succeeded")
+	}
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const APIKeyPrefix = "gm_"
+
+// GenerateAPIKey returns a new secret key together with the short prefix that
+// is kept in clear text so users can tell their keys apart.
+func GenerateAPIKey() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return key, key[:len(APIKeyPrefix)+8], nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/models"
+)
+
+const auditWriteTimeout = 5 * time.Second
+
+// AuditSink persists audit events. storage.AuditStorage satisfies it.
+type AuditSink interface {
+	RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error
+}
+
+type AuditEmitter struct {
+	sink AuditSink
+}
+
+func NewAuditEmitter(sink AuditSink) AuditEmitter {
+	return AuditEmitter{sink: sink}
+}
+
+// Emit records event. The write outlives a cancelled request, and a failure
+// is logged rather than returned so that auditing never breaks the operation
+// being audited.
+func (e AuditEmitter) Emit(ctx context.Context, event models.AuditEvent) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditWriteTimeout)
+	defer cancel()
+
+	if err := e.sink.RecordAuditEvent(ctx, &event); err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to record audit event", "type", event.Type, "user_id", event.UserID, "error", err)
+	}
+}
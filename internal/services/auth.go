@@ -1,34 +1,176 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	HashAlgorithmBcrypt   = "bcrypt"
+	HashAlgorithmArgon2id = "argon2id"
+)
+
+var ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+
 type AuthService interface {
 	HashPassword(password string) (string, error)
 	VerifyPassword(hashedPassword, password string) error
+	NeedsRehash(hashedPassword string) bool
 }
 
-type authService struct{}
+type HashOptions struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
 
-func NewAuthService() AuthService {
-	return &authService{}
+type authService struct {
+	opts HashOptions
+}
+
+func NewAuthService(opts HashOptions) AuthService {
+	if opts.Algorithm == "" {
+		opts.Algorithm = HashAlgorithmBcrypt
+	}
+	if opts.BcryptCost == 0 {
+		opts.BcryptCost = bcrypt.DefaultCost
+	}
+	if opts.Argon2Time == 0 {
+		opts.Argon2Time = 1
+	}
+	if opts.Argon2Memory == 0 {
+		opts.Argon2Memory = 64 * 1024
+	}
+	if opts.Argon2Threads == 0 {
+		opts.Argon2Threads = 4
+	}
+	return &authService{opts: opts}
 }
 
 func (s *authService) HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	switch s.opts.Algorithm {
+	case HashAlgorithmBcrypt:
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.opts.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashedPassword), nil
+	case HashAlgorithmArgon2id:
+		return s.hashArgon2id(password)
+	default:
+		return "", ErrUnknownHashAlgorithm
 	}
-	return string(hashedPassword), nil
 }
 
 func (s *authService) VerifyPassword(hashedPassword, password string) error {
+	if strings.HasPrefix(hashedPassword, "$argon2id$") {
+		return verifyArgon2id(hashedPassword, password)
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	if err != nil {
 		return errors.New("invalid password")
 	}
 	return nil
 }
+
+// NeedsRehash reports whether hashedPassword was produced with an algorithm or
+// cost other than the configured one.
+func (s *authService) NeedsRehash(hashedPassword string) bool {
+	if strings.HasPrefix(hashedPassword, "$argon2id$") {
+		if s.opts.Algorithm != HashAlgorithmArgon2id {
+			return true
+		}
+		params, err := parseArgon2id(hashedPassword)
+		if err != nil {
+			return true
+		}
+		return params.time != s.opts.Argon2Time ||
+			params.memory != s.opts.Argon2Memory ||
+			params.threads != s.opts.Argon2Threads
+	}
+
+	if s.opts.Algorithm != HashAlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		return true
+	}
+	return cost != s.opts.BcryptCost
+}
+
+type argon2idHash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (s *authService) hashArgon2id(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, s.opts.Argon2Time, s.opts.Argon2Memory, s.opts.Argon2Threads, 32)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, s.opts.Argon2Memory, s.opts.Argon2Time, s.opts.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func parseArgon2id(hashedPassword string) (*argon2idHash, error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, err
+	}
+	if version != argon2.Version {
+		return nil, errors.New("unsupported argon2 version")
+	}
+
+	var h argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+func verifyArgon2id(hashedPassword, password string) error {
+	h, err := parseArgon2id(hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	if subtle.ConstantTimeCompare(key, h.key) != 1 {
+		return errors.New("invalid password")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// Cheap parameters keep the tests fast; they are not meant for production.
+var (
+	testBcrypt   = HashOptions{Algorithm: HashAlgorithmBcrypt, BcryptCost: 4}
+	testArgon2id = HashOptions{Algorithm: HashAlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+)
+
+func TestHashAndVerifyPassword(t *testing.T) {
+	for _, opts := range []HashOptions{testBcrypt, testArgon2id} {
+		t.Run(opts.Algorithm, func(t *testing.T) {
+			auth := NewAuthService(opts)
+
+			hash, err := auth.HashPassword("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := auth.VerifyPassword(hash, "correct horse"); err != nil {
+				t.Errorf("VerifyPassword of the right password: %v", err)
+			}
+			if err := auth.VerifyPassword(hash, "wrong horse"); err == nil {
+				t.Error("VerifyPassword accepted a wrong password")
+			}
+			if auth.NeedsRehash(hash) {
+				t.Error("NeedsRehash of a fresh hash = true")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash := func(opts HashOptions) string {
+		t.Helper()
+		hash, err := NewAuthService(opts).HashPassword("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	bcryptCost5 := testBcrypt
+	bcryptCost5.BcryptCost = 5
+	argon2idTime2 := testArgon2id
+	argon2idTime2.Argon2Time = 2
+	argon2idMemory := testArgon2id
+	argon2idMemory.Argon2Memory = 2048
+	argon2idThreads := testArgon2id
+	argon2idThreads.Argon2Threads = 2
+
+	tests := []struct {
+		name   string
+		opts   HashOptions
+		hash   string
+		rehash bool
+	}{
+		{name: "bcrypt, same cost", opts: testBcrypt, hash: hash(testBcrypt), rehash: false},
+		{name: "bcrypt, other cost", opts: testBcrypt, hash: hash(bcryptCost5), rehash: true},
+		{name: "bcrypt to argon2id", opts: testArgon2id, hash: hash(testBcrypt), rehash: true},
+		{name: "argon2id to bcrypt", opts: testBcrypt, hash: hash(testArgon2id), rehash: true},
+		{name: "argon2id, other time", opts: testArgon2id, hash: hash(argon2idTime2), rehash: true},
+		{name: "argon2id, other memory", opts: testArgon2id, hash: hash(argon2idMemory), rehash: true},
+		{name: "argon2id, other threads", opts: testArgon2id, hash: hash(argon2idThreads), rehash: true},
+		{name: "malformed argon2id", opts: testArgon2id, hash: "$argon2id$v=19$garbage", rehash: true},
+		{name: "malformed bcrypt", opts: testBcrypt, hash: "not a hash", rehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewAuthService(tt.opts).NeedsRehash(tt.hash); got != tt.rehash {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestArgon2idVerifiesBcryptHashes(t *testing.T) {
+	legacy, err := NewAuthService(testBcrypt).HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := NewAuthService(testArgon2id)
+	if err := auth.VerifyPassword(legacy, "correct horse"); err != nil {
+		t.Fatalf("VerifyPassword of a bcrypt hash: %v", err)
+	}
+	upgraded, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(upgraded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("HashPassword = %q, want an argon2id hash with the configured parameters", upgraded)
+	}
+}
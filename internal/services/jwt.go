@@ -1,53 +1,151 @@
 package services
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	purposeTwoFactor = "2fa"
+	purposeOIDCFlow  = "oidc"
+)
+
+var ErrTokenPurpose = errors.New("token issued for a different purpose")
+
 type JWTService interface {
-	GenerateToken(userID int64, expirationTime time.Time) string
-	VerifyToken(tokenString string) (int64, error)
+	GenerateToken(userID int64, tokenVersion int, expirationTime time.Time) string
+	VerifyToken(tokenString string) (*Claims, error)
+	GenerateChallengeToken(userID int64, tokenVersion int, method string, expirationTime time.Time) string
+	VerifyChallengeToken(tokenString string) (*Claims, error)
+	GenerateOIDCFlowToken(flow OIDCFlow, expirationTime time.Time) string
+	VerifyOIDCFlowToken(tokenString string) (*OIDCFlow, error)
 }
 
-type jwtService struct{}
+// OIDCFlow is the state of an OpenID Connect login kept by the browser
+// between the redirect to the issuer and the callback.
+type OIDCFlow struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	LinkUserID   int64  `json:"link_user_id,omitempty"`
+}
+
+type jwtService struct {
+	secret []byte
+}
 
-func NewJWTService() JWTService {
-	return &jwtService{}
+func NewJWTService(secret string) JWTService {
+	return &jwtService{secret: []byte(secret)}
 }
 
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID int64 `json:"user_id"`
+	UserID       int64     `json:"user_id"`
+	TokenVersion int       `json:"ver"`
+	Purpose      string    `json:"purpose,omitempty"`
+	Method       string    `json:"method,omitempty"`
+	Flow         *OIDCFlow `json:"flow,omitempty"`
 }
 
-func (j *jwtService) GenerateToken(userID int64, expirationTime time.Time) string {
-	var tokenString string
+func (j *jwtService) GenerateToken(userID int64, tokenVersion int, expirationTime time.Time) string {
+	return j.sign(&Claims{
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+}
+
+func (j *jwtService) VerifyToken(tokenString string) (*Claims, error) {
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != "" {
+		return nil, ErrTokenPurpose
+	}
+
+	return claims, nil
+}
+
+// GenerateChallengeToken issues a short-lived token proving that the first
+// step of a two-factor login, by password or OIDC as given by method,
+// succeeded. It is not accepted as a session, and like one it is bound to the
+// token version of the user.
+func (j *jwtService) GenerateChallengeToken(userID int64, tokenVersion int, method string, expirationTime time.Time) string {
+	return j.sign(&Claims{
+		UserID:       userID,
+		TokenVersion: tokenVersion,
+		Purpose:      purposeTwoFactor,
+		Method:       method,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+}
+
+func (j *jwtService) VerifyChallengeToken(tokenString string) (*Claims, error) {
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purposeTwoFactor {
+		return nil, ErrTokenPurpose
+	}
+
+	return claims, nil
+}
 
-	claims := &Claims{
-		UserID: userID,
+func (j *jwtService) GenerateOIDCFlowToken(flow OIDCFlow, expirationTime time.Time) string {
+	return j.sign(&Claims{
+		Purpose: purposeOIDCFlow,
+		Flow:    &flow,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
+	})
+}
+
+func (j *jwtService) VerifyOIDCFlowToken(tokenString string) (*OIDCFlow, error) {
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purposeOIDCFlow || claims.Flow == nil {
+		return nil, ErrTokenPurpose
 	}
 
+	return claims.Flow, nil
+}
+
+func (j *jwtService) sign(claims *Claims) string {
+	var tokenString string
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ = token.SignedString([]byte("qwerty"))
+	tokenString, _ = token.SignedString(j.secret)
 
 	return tokenString
 }
 
-func (j *jwtService) VerifyToken(tokenString string) (int64, error) {
+func (j *jwtService) parse(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
 	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte("qwerty"), nil
+		return j.secret, nil
 	})
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
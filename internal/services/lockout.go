@@ -0,0 +1,31 @@
+package services
+
+import "time"
+
+type LockoutPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Window      time.Duration
+}
+
+// LockDuration returns how long a key must stay locked after the given number
+// of consecutive failures. The delay doubles for every failure past MaxAttempts.
+func (p LockoutPolicy) LockDuration(failures int) time.Duration {
+	if p.MaxAttempts <= 0 || failures < p.MaxAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.MaxAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyLockDuration(t *testing.T) {
+	policy := LockoutPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		name     string
+		policy   LockoutPolicy
+		failures int
+		want     time.Duration
+	}{
+		{name: "no failures", policy: policy, failures: 0, want: 0},
+		{name: "below the limit", policy: policy, failures: 2, want: 0},
+		{name: "at the limit", policy: policy, failures: 3, want: time.Second},
+		{name: "one past the limit", policy: policy, failures: 4, want: 2 * time.Second},
+		{name: "two past the limit", policy: policy, failures: 5, want: 4 * time.Second},
+		{name: "three past the limit", policy: policy, failures: 6, want: 8 * time.Second},
+		{name: "capped", policy: policy, failures: 7, want: 10 * time.Second},
+		{name: "far past the limit", policy: policy, failures: 1000, want: 10 * time.Second},
+		{
+			name:     "base above the cap",
+			policy:   LockoutPolicy{MaxAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Second},
+			failures: 1,
+			want:     time.Second,
+		},
+		{
+			name:     "disabled",
+			policy:   LockoutPolicy{BaseDelay: time.Second, MaxDelay: time.Minute},
+			failures: 100,
+			want:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.LockDuration(tt.failures); got != tt.want {
+				t.Errorf("LockDuration(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrOIDCNonce      = errors.New("id token nonce mismatch")
+	ErrOIDCUnknownKey = errors.New("id token signed with unknown key")
+)
+
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	PreferredUsername string
+}
+
+// OIDCService implements the OpenID Connect authorization code flow with PKCE
+// against a single issuer.
+type OIDCService interface {
+	AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error)
+}
+
+type oidcDiscovery struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// jwksRefreshInterval limits how often tokens with an unknown key id can
+// make the key set be fetched again.
+const jwksRefreshInterval = time.Minute
+
+type oidcService struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]interface{}
+	keysFetched time.Time
+
+	// fetchMu serialises fetches of the key set, so that lookups of known
+	// keys never wait for the network.
+	fetchMu sync.Mutex
+}
+
+func NewOIDCService(cfg OIDCConfig) OIDCService {
+	return &oidcService{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewPKCEVerifier returns a random code verifier and random state and nonce
+// values for a new login attempt.
+func NewPKCEVerifier() (verifier, state, nonce string, err error) {
+	values := make([]string, 3)
+	for i := range values {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return "", "", "", err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return values[0], values[1], values[2], nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (s *oidcService) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	wellKnown := strings.TrimSuffix(s.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := s.getJSON(ctx, wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+
+	if discovery.Issuer != s.cfg.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, s.cfg.IssuerURL)
+	}
+
+	s.discovery = &discovery
+	return s.discovery, nil
+}
+
+func (s *oidcService) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (s *oidcService) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := s.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", s.cfg.ClientID)
+	query.Set("redirect_uri", s.cfg.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", pkceChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (s *oidcService) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	discovery, err := s.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", s.cfg.ClientID)
+
+	usePost := slices.Contains(discovery.TokenEndpointAuthMethods, "client_secret_post") &&
+		!slices.Contains(discovery.TokenEndpointAuthMethods, "client_secret_basic")
+	if usePost {
+		form.Set("client_secret", s.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !usePost {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return s.verifyIDToken(ctx, discovery, token.IDToken, nonce)
+}
+
+func (s *oidcService) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, rawIDToken, nonce string) (*OIDCIdentity, error) {
+	claims := &idTokenClaims{}
+
+	_, err := jwt.ParseWithClaims(rawIDToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return s.getKey(ctx, discovery, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(s.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce != nonce {
+		return nil, ErrOIDCNonce
+	}
+
+	return &OIDCIdentity{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// getKey returns the verification key with the given id. The key set is
+// fetched again when the id is unknown, which picks up issuer key rotation,
+// but at most once per jwksRefreshInterval.
+func (s *oidcService) getKey(ctx context.Context, discovery *oidcDiscovery, kid string) (interface{}, error) {
+	if key, ok, _ := s.cachedKey(kid); ok {
+		return key, nil
+	}
+
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	// The key set may have been fetched while waiting.
+	key, ok, fetched := s.cachedKey(kid)
+	if ok {
+		return key, nil
+	}
+	if !fetched.IsZero() && time.Since(fetched) < jwksRefreshInterval {
+		return nil, ErrOIDCUnknownKey
+	}
+
+	keys, err := s.fetchKeys(ctx, discovery)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Failed fetches count too, so that the issuer is not hammered while
+	// it is down.
+	s.keysFetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrOIDCUnknownKey
+}
+
+func (s *oidcService) cachedKey(kid string) (interface{}, bool, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[kid]
+	return key, ok, s.keysFetched
+}
+
+func (s *oidcService) fetchKeys(ctx context.Context, discovery *oidcDiscovery) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := s.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
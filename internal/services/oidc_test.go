@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/services/oidctest"
+)
+
+const (
+	testClientID     = "gophermart"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://gophermart.test/api/user/oidc/callback"
+)
+
+func newOIDCService(issuer *oidctest.Issuer) services.OIDCService {
+	return services.NewOIDCService(services.OIDCConfig{
+		IssuerURL:    issuer.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+}
+
+// login runs the authorization code flow, exchanging with exchangeVerifier
+// when set instead of the verifier the flow was started with.
+func login(t *testing.T, issuer *oidctest.Issuer, oidc services.OIDCService, token oidctest.Token, exchangeVerifier string) (*services.OIDCIdentity, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier, state, nonce, err := services.NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := oidc.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, returnedState, err := issuer.Authorize(authURL, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returnedState != state {
+		t.Fatalf("state = %q, want %q", returnedState, state)
+	}
+
+	if exchangeVerifier == "" {
+		exchangeVerifier = verifier
+	}
+	return oidc.Exchange(ctx, code, exchangeVerifier, nonce)
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID, testClientSecret)
+	oidc := newOIDCService(issuer)
+
+	identity, err := login(t, issuer, oidc, oidctest.Token{
+		Subject:           "subject-1",
+		Email:             "alice@example.com",
+		PreferredUsername: "alice",
+	}, "")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := services.OIDCIdentity{
+		Issuer:            issuer.URL,
+		Subject:           "subject-1",
+		Email:             "alice@example.com",
+		PreferredUsername: "alice",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    oidctest.Token
+		verifier string
+		wantErr  error
+	}{
+		{name: "wrong issuer", token: oidctest.Token{Issuer: "https://evil.example.com"}},
+		{name: "wrong audience", token: oidctest.Token{Audience: "another-client"}},
+		{name: "expired", token: oidctest.Token{ExpiresAt: time.Now().Add(-time.Hour)}},
+		{name: "wrong nonce", token: oidctest.Token{Nonce: "replayed"}, wantErr: services.ErrOIDCNonce},
+		{name: "PKCE verifier mismatch", verifier: "not-the-verifier-the-flow-started-with"},
+		{name: "unknown key", token: oidctest.Token{KeyID: "rotated-away"}, wantErr: services.ErrOIDCUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := oidctest.NewIssuer(t, testClientID, testClientSecret)
+			oidc := newOIDCService(issuer)
+
+			tt.token.Subject = "subject-1"
+			identity, err := login(t, issuer, oidc, tt.token, tt.verifier)
+			if err == nil {
+				t.Fatalf("Exchange accepted the token: %+v", identity)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exchange error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCUnknownKeyRefetchIsRateLimited(t *testing.T) {
+	issuer := oidctest.NewIssuer(t, testClientID, testClientSecret)
+	oidc := newOIDCService(issuer)
+
+	if _, err := login(t, issuer, oidc, oidctest.Token{Subject: "subject-1"}, ""); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := login(t, issuer, oidc, oidctest.Token{Subject: "subject-1", KeyID: "unknown"}, "")
+		if !errors.Is(err, services.ErrOIDCUnknownKey) {
+			t.Fatalf("Exchange error = %v, want %v", err, services.ErrOIDCUnknownKey)
+		}
+	}
+
+	if got := issuer.JWKSRequests.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+}
@@ -0,0 +1,223 @@
+// Package oidctest provides a stand-in OpenID Connect issuer for tests. It
+// serves discovery, JWKS and token endpoints and checks PKCE.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "test-key"
+
+// Token overrides claims of the ID token issued for an authorization. Zero
+// values get valid defaults.
+type Token struct {
+	Subject           string
+	Email             string
+	PreferredUsername string
+
+	Issuer    string
+	Audience  string
+	ExpiresAt time.Time
+	Nonce     string
+	KeyID     string
+}
+
+type grant struct {
+	token         Token
+	codeChallenge string
+	redirectURI   string
+}
+
+type Issuer struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	// JWKSRequests counts the fetches of the key set.
+	JWKSRequests atomic.Int32
+
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// NewIssuer starts an issuer that is closed with the test.
+func NewIssuer(t testing.TB, clientID, clientSecret string) *Issuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		grants:       make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/token", issuer.token)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	issuer.URL = server.URL
+	return issuer
+}
+
+// Authorize stands in for the user signing in at the authorization URL
+// built by the service. It returns the code and state the browser brings
+// back to the callback.
+func (i *Issuer) Authorize(authURL string, token Token) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+	if query.Get("client_id") != i.ClientID {
+		return "", "", errors.New("unknown client_id")
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		return "", "", errors.New("PKCE S256 is required")
+	}
+	if token.Nonce == "" {
+		token.Nonce = query.Get("nonce")
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	code = base64.RawURLEncoding.EncodeToString(raw)
+
+	i.mu.Lock()
+	i.grants[code] = grant{
+		token:         token,
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+	}
+	i.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.JWKSRequests.Add(1)
+
+	public := i.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kid": keyID,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != i.ClientID || clientSecret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	g, ok := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := i.sign(g.token)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (i *Issuer) sign(token Token) (string, error) {
+	if token.Issuer == "" {
+		token.Issuer = i.URL
+	}
+	if token.Audience == "" {
+		token.Audience = i.ClientID
+	}
+	if token.ExpiresAt.IsZero() {
+		token.ExpiresAt = time.Now().Add(5 * time.Minute)
+	}
+	if token.KeyID == "" {
+		token.KeyID = keyID
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   token.Issuer,
+		"sub":   token.Subject,
+		"aud":   token.Audience,
+		"exp":   token.ExpiresAt.Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": token.Nonce,
+	}
+	if token.Email != "" {
+		claims["email"] = token.Email
+	}
+	if token.PreferredUsername != "" {
+		claims["preferred_username"] = token.PreferredUsername
+	}
+
+	signed := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	signed.Header["kid"] = token.KeyID
+	return signed.SignedString(i.key)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
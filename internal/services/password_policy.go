@@ -0,0 +1,65 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrPasswordTooShort    = errors.New("password is too short")
+	ErrPasswordBreached    = errors.New("password is known to be breached")
+	ErrPasswordEqualsLogin = errors.New("password must not be equal to login")
+)
+
+type PasswordPolicy struct {
+	MinLength int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy builds a policy. breachedFile, when set, is a list of
+// forbidden passwords, one per line.
+func NewPasswordPolicy(minLength int, breachedFile string) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength: minLength,
+		breached:  make(map[string]struct{}),
+	}
+
+	if breachedFile == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(breachedFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			policy.breached[line] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (p *PasswordPolicy) Validate(login, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength || password == "" {
+		return ErrPasswordTooShort
+	}
+	if strings.EqualFold(password, login) {
+		return ErrPasswordEqualsLogin
+	}
+	if _, ok := p.breached[password]; ok {
+		return ErrPasswordBreached
+	}
+	return nil
+}
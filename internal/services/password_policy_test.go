@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	breachedFile := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breachedFile, []byte("password123\n\n  letmein-please  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPasswordPolicy(8, breachedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		wantErr  error
+	}{
+		{name: "acceptable", login: "alice", password: "correct horse", wantErr: nil},
+		{name: "empty", login: "alice", password: "", wantErr: ErrPasswordTooShort},
+		{name: "too short", login: "alice", password: "1234567", wantErr: ErrPasswordTooShort},
+		{name: "length in characters", login: "alice", password: "пароль12", wantErr: nil},
+		{name: "short in characters", login: "alice", password: "пароль1", wantErr: ErrPasswordTooShort},
+		{name: "equals login", login: "alice-in-chains", password: "alice-in-chains", wantErr: ErrPasswordEqualsLogin},
+		{name: "equals login in another case", login: "alice-in-chains", password: "Alice-In-Chains", wantErr: ErrPasswordEqualsLogin},
+		{name: "breached", login: "alice", password: "password123", wantErr: ErrPasswordBreached},
+		{name: "breached entry is trimmed", login: "alice", password: "letmein-please", wantErr: ErrPasswordBreached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := policy.Validate(tt.login, tt.password); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate(%q, %q) = %v, want %v", tt.login, tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPasswordPolicyMissingFile(t *testing.T) {
+	if _, err := NewPasswordPolicy(8, filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("NewPasswordPolicy accepted a missing breached password file")
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPValidateRFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; these are their last 6 digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	totp, err := NewTOTPService("gophermart", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			now := time.Unix(tt.unix, 0)
+			step, ok := totp.Validate(rfc6238Secret, tt.code, now)
+			if !ok || step != tt.unix/totpPeriod {
+				t.Errorf("Validate at %d = %d, %v; want %d, true", tt.unix, step, ok, tt.unix/totpPeriod)
+			}
+			if _, ok := totp.Validate(strings.ToLower(rfc6238Secret), tt.code, now); !ok {
+				t.Error("Validate rejected a lower-case secret")
+			}
+			if _, ok := totp.Validate(rfc6238Secret, tt.code, now.Add(3*totpPeriod*time.Second)); ok {
+				t.Error("Validate accepted a code three steps old")
+			}
+		})
+	}
+}
+
+func TestTOTPValidateRejectsMalformedInput(t *testing.T) {
+	totp, err := NewTOTPService("gophermart", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(59, 0)
+
+	for name, input := range map[string][2]string{
+		"short code":     {rfc6238Secret, "28708"},
+		"8-digit code":   {rfc6238Secret, "94287082"},
+		"invalid secret": {"not base32!", "287082"},
+	} {
+		if _, ok := totp.Validate(input[0], input[1], now); ok {
+			t.Errorf("%s: Validate accepted it", name)
+		}
+	}
+}
+
+func TestTOTPSealSecret(t *testing.T) {
+	totp, err := NewTOTPService("gophermart", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := totp.SealSecret(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, sealedSecretPrefix) || strings.Contains(sealed, rfc6238Secret) {
+		t.Fatalf("SealSecret = %q, want an encrypted %q value", sealed, sealedSecretPrefix)
+	}
+	again, err := totp.SealSecret(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Error("SealSecret reused its nonce")
+	}
+
+	opened, err := totp.OpenSecret(sealed)
+	if err != nil || opened != rfc6238Secret {
+		t.Errorf("OpenSecret = %q, %v; want %q", opened, err, rfc6238Secret)
+	}
+
+	if legacy, err := totp.OpenSecret(rfc6238Secret); err != nil || legacy != rfc6238Secret {
+		t.Errorf("OpenSecret of a plaintext secret = %q, %v; want it unchanged", legacy, err)
+	}
+
+	other, err := NewTOTPService("gophermart", "another key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.OpenSecret(sealed); !errors.Is(err, ErrSealedSecret) {
+		t.Errorf("OpenSecret with another key: error = %v, want ErrSealedSecret", err)
+	}
+	if _, err := totp.OpenSecret(sealedSecretPrefix + "AAAA"); !errors.Is(err, ErrSealedSecret) {
+		t.Errorf("OpenSecret of a truncated secret: error = %v, want ErrSealedSecret", err)
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+type APIKeyStorage interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error
+	ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID int64) error
+	RevokeAllAPIKeys(ctx context.Context, userID int64) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error
+}
+
+type apiKeyStorage struct {
+	db querier
+}
+
+func NewAPIKeyStorage(dbPool *pgxpool.Pool) APIKeyStorage {
+	return &apiKeyStorage{
+		db: dbPool,
+	}
+}
+
+func (store *apiKeyStorage) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	row := store.db.QueryRow(ctx,
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		key.UserID, key.Name, key.Prefix, keyHash, key.Scopes, key.ExpiresAt)
+
+	return row.Scan(&key.ID, &key.CreatedAt)
+}
+
+func (store *apiKeyStorage) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	rows, err := store.db.Query(ctx,
+		`SELECT id, user_id, name, prefix, scopes, expires_at, created_at, last_used_at
+		FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scopes,
+			&key.ExpiresAt, &key.CreatedAt, &key.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (store *apiKeyStorage) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	tag, err := store.db.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		keyID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *apiKeyStorage) RevokeAllAPIKeys(ctx context.Context, userID int64) error {
+	_, err := store.db.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return err
+}
+
+// GetAPIKeyByHash returns the active key with the given hash. Revoked keys are
+// reported as ErrNotFound; expiry is left to the caller.
+func (store *apiKeyStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	row := store.db.QueryRow(ctx,
+		`SELECT id, user_id, name, prefix, scopes, expires_at, created_at, last_used_at
+		FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, keyHash)
+
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scopes,
+		&key.ExpiresAt, &key.CreatedAt, &key.LastUsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (store *apiKeyStorage) TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error {
+	_, err := store.db.Exec(ctx,
+		"UPDATE api_keys SET last_used_at = $2 WHERE id = $1", keyID, usedAt)
+	return err
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+type AuditStorage interface {
+	RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error)
+	DeleteAuditEventsBefore(ctx context.Context, before time.Time) (int64, error)
+	// PseudonymizeAuditEvents clears the IP address and user agent of the
+	// user's events, and of events naming login, and drops login from them.
+	PseudonymizeAuditEvents(ctx context.Context, userID int64, login string) error
+}
+
+type auditStorage struct {
+	db querier
+}
+
+// nullUserID stores events without a known user as NULL.
+func nullUserID(userID int64) *int64 {
+	if userID == 0 {
+		return nil
+	}
+	return &userID
+}
+
+func (store *auditStorage) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	row := store.db.QueryRow(ctx,
+		`INSERT INTO audit_events (type, user_id, ip, user_agent, request_id, details)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		event.Type, nullUserID(event.UserID), event.IP, event.UserAgent, event.RequestID, event.Details)
+
+	return row.Scan(&event.ID, &event.CreatedAt)
+}
+
+func (store *auditStorage) ListAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if query.UserID != 0 {
+		conditions = append(conditions, "user_id = "+arg(query.UserID))
+	}
+	if query.Type != "" {
+		conditions = append(conditions, "type = "+arg(query.Type))
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(query.From))
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(query.To))
+	}
+	if query.BeforeID != 0 {
+		conditions = append(conditions, "id < "+arg(query.BeforeID))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := store.db.Query(ctx, fmt.Sprintf(
+		`SELECT id, type, user_id, ip, user_agent, request_id, details, created_at
+		FROM audit_events %s ORDER BY id DESC LIMIT %s`, where, arg(query.Limit)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		var userID *int64
+		err := rows.Scan(&event.ID, &event.Type, &userID, &event.IP, &event.UserAgent,
+			&event.RequestID, &event.Details, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if userID != nil {
+			event.UserID = *userID
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (store *auditStorage) DeleteAuditEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := store.db.Exec(ctx, "DELETE FROM audit_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (store *auditStorage) PseudonymizeAuditEvents(ctx context.Context, userID int64, login string) error {
+	_, err := store.db.Exec(ctx,
+		`UPDATE audit_events SET ip = '', user_agent = '', details = details - 'login'
+		WHERE user_id = $1 OR details->>'login' = $2`,
+		userID, login)
+	return err
+}
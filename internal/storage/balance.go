@@ -13,13 +13,14 @@ import (
 var ErrInsufficientFunds = errors.New("insufficient funds")
 
 type BalanceStorage interface {
-	GetUserBalance(userID int64) (*models.UserBalance, error)
-	CheckBalanceWithdrawal(userID int64, amount float32) error
-	GetWithdrawalsByUserID(userID int64) (*[]models.UserWithdrawal, error)
+	GetUserBalance(ctx context.Context, userID int64) (*models.UserBalance, error)
+	CheckBalanceWithdrawal(ctx context.Context, userID int64, amount float32) error
+	GetWithdrawalsByUserID(ctx context.Context, userID int64) (*[]models.UserWithdrawal, error)
 }
 
 type balanceStorage struct {
-	db *pgxpool.Pool
+	db      querier
+	replica *readReplica
 }
 
 func NewBalanceStorage(dbPool *pgxpool.Pool) BalanceStorage {
@@ -28,36 +29,38 @@ func NewBalanceStorage(dbPool *pgxpool.Pool) BalanceStorage {
 	}
 }
 
-func (store *balanceStorage) GetUserBalance(userID int64) (*models.UserBalance, error) {
+func (store *balanceStorage) GetUserBalance(ctx context.Context, userID int64) (*models.UserBalance, error) {
 	var userBalance models.UserBalance
 
-	row := store.db.QueryRow(context.Background(),
-		"SELECT SUM(accrual) - SUM(withdrawn) AS accrual, SUM(withdrawn) withdrawn FROM orders WHERE user_id = $1", userID)
+	row := store.db.QueryRow(ctx,
+		"SELECT COALESCE(SUM(accrual) - SUM(withdrawn), 0), COALESCE(SUM(withdrawn), 0) FROM orders WHERE user_id = $1", userID)
 
-	row.Scan(&userBalance.Current, &userBalance.Withdraw)
+	if err := row.Scan(&userBalance.Current, &userBalance.Withdraw); err != nil {
+		return nil, err
+	}
 
 	return &userBalance, nil
 }
 
-func (store *balanceStorage) CheckBalanceWithdrawal(userID int64, amount float32) error {
+func (store *balanceStorage) CheckBalanceWithdrawal(ctx context.Context, userID int64, amount float32) error {
 
-	userBalance, err := store.GetUserBalance(userID)
+	userBalance, err := store.GetUserBalance(ctx, userID)
 	if err != nil {
 		return err
 	}
 
 	if userBalance.Current < 0 {
-		logger.Log.Error("Insufficient funds", "balance", userBalance.Current, "withdrawal", amount)
+		logger.Log.ErrorContext(ctx, "Insufficient funds", "balance", userBalance.Current, "withdrawal", amount)
 		return ErrInsufficientFunds
 	}
 
 	return nil
 }
 
-func (store *balanceStorage) GetWithdrawalsByUserID(userID int64) (*[]models.UserWithdrawal, error) {
+func (store *balanceStorage) GetWithdrawalsByUserID(ctx context.Context, userID int64) (*[]models.UserWithdrawal, error) {
 	var userWithdrawals []models.UserWithdrawal
 
-	rows, err := store.db.Query(context.Background(),
+	rows, err := store.replica.Query(ctx, store.db,
 		"SELECT id, withdrawn, uploaded_at FROM orders WHERE user_id = $1 ORDER BY uploaded_at DESC", userID)
 	if err != nil {
 		return nil, err
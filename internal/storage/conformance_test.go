@@ -0,0 +1,474 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+	"github.com/learies/gofermart/internal/storage/memory"
+	"github.com/learies/gofermart/internal/storage/postgres"
+	"github.com/learies/gofermart/internal/storage/sqlite"
+)
+
+// testDatabaseEnv names a PostgreSQL database to run the suite against. The
+// pgx backend is skipped when it is not set.
+const testDatabaseEnv = "TEST_DATABASE_URI"
+
+var withdrawTxOptions = storage.TxOptions{Isolation: storage.Serializable, MaxRetries: 10}
+
+func TestMain(m *testing.M) {
+	if err := logger.NewLogger(logger.Options{Level: "error", Format: "text", Output: "stderr"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type backend struct {
+	name string
+	open func(t *testing.T, auth services.AuthService) *storage.Storage
+}
+
+var backends = []backend{
+	{name: "memory", open: func(t *testing.T, auth services.AuthService) *storage.Storage {
+		return memory.New(auth)
+	}},
+	{name: "sqlite", open: func(t *testing.T, auth services.AuthService) *storage.Storage {
+		db, err := sqlite.Open(context.Background(), "sqlite://"+filepath.Join(t.TempDir(), "gophermart.db"), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return sqlite.New(db, auth)
+	}},
+	{name: "pgx", open: func(t *testing.T, auth services.AuthService) *storage.Storage {
+		dsn := os.Getenv(testDatabaseEnv)
+		if dsn == "" {
+			t.Skipf("%s is not set", testDatabaseEnv)
+		}
+		pool, err := postgres.SetupDB(postgres.PoolConfig{DSN: dsn, MaxConns: 20, StartupTimeout: 10 * time.Second}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		return storage.NewPostgres(pool, nil, auth)
+	}},
+}
+
+// TestConformance runs the same behavioural checks against every backend.
+// Backends share no state between tests, but the pgx database may hold data
+// of earlier runs, so every test works with fresh logins and order numbers.
+func TestConformance(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store *storage.Storage)
+	}{
+		{name: "duplicate login conflicts", run: testDuplicateLogin},
+		{name: "duplicate order conflicts", run: testDuplicateOrder},
+		{name: "withdrawal beyond balance", run: testInsufficientFunds},
+		{name: "orders by upload time", run: testOrdersByUploadTime},
+		{name: "concurrent withdrawals", run: testConcurrentWithdrawals},
+		{name: "totp enrolment", run: testTOTPEnrolment},
+		{name: "balance without orders", run: testEmptyBalance},
+		{name: "claim pending orders", run: testClaimPendingOrders},
+		{name: "nested transactions", run: testNestedTx},
+	}
+
+	auth := services.NewAuthService(services.HashOptions{BcryptCost: 4})
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			store := b.open(t, auth)
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.run(t, store)
+				})
+			}
+		})
+	}
+}
+
+// TestBalanceReportsStorageErrors checks that a failed balance read is an
+// error rather than a zero balance, which would turn into a 402 inside a
+// withdrawal. The memory backend cannot fail and is left out.
+func TestBalanceReportsStorageErrors(t *testing.T) {
+	auth := services.NewAuthService(services.HashOptions{BcryptCost: 4})
+	for _, b := range backends {
+		if b.name == "memory" {
+			continue
+		}
+		t.Run(b.name, func(t *testing.T) {
+			store := b.open(t, auth)
+			userID := newUser(t, store)
+			fund(t, store, userID, 100)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			balance, err := store.Balance.GetUserBalance(ctx, userID)
+			if !storage.IsUnavailable(err) {
+				t.Errorf("GetUserBalance with a cancelled context = %v, %v; want an unavailable error", balance, err)
+			}
+			if err := store.Balance.CheckBalanceWithdrawal(ctx, userID, 10); errors.Is(err, storage.ErrInsufficientFunds) || err == nil {
+				t.Errorf("CheckBalanceWithdrawal with a cancelled context: error = %v, want the storage error", err)
+			}
+		})
+	}
+}
+
+var uniqueSeq atomic.Int64
+
+// unique returns a value that no earlier test or run has used.
+func unique() string {
+	return fmt.Sprintf("%d%04d", time.Now().UnixNano()/int64(time.Millisecond), uniqueSeq.Add(1))
+}
+
+func newUser(t *testing.T, store *storage.Storage) int64 {
+	t.Helper()
+	userID, err := store.Users.CreateUser(context.Background(), "user-"+unique(), "Password123!x")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return userID
+}
+
+// fund gives the user a processed order worth accrual.
+func fund(t *testing.T, store *storage.Storage, userID int64, accrual float32) {
+	t.Helper()
+	err := store.Orders.CreateOrder(context.Background(), models.Order{
+		OrderID: unique(),
+		Status:  "PROCESSED",
+		Accrual: accrual,
+		UserID:  userID,
+	})
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+}
+
+// withdraw records a withdrawal the way the handler does, rolling it back if
+// it overdraws the balance.
+func withdraw(store *storage.Storage, userID int64, orderID string, sum float32) error {
+	return store.Tx.WithinTx(context.Background(), withdrawTxOptions, func(ctx context.Context, tx *storage.Storage) error {
+		err := tx.Orders.CreateOrder(ctx, models.Order{OrderID: orderID, Status: "NEW", Withdrawn: sum, UserID: userID})
+		if err != nil {
+			return err
+		}
+		return tx.Balance.CheckBalanceWithdrawal(ctx, userID, sum)
+	})
+}
+
+func testDuplicateLogin(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	login := "user-" + unique()
+
+	if _, err := store.Users.CreateUser(ctx, login, "Password123!x"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := store.Users.CreateUser(ctx, login, "Password456!y"); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("second CreateUser error = %v, want %v", err, storage.ErrConflict)
+	}
+}
+
+func testDuplicateOrder(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	owner, other := newUser(t, store), newUser(t, store)
+	orderID := unique()
+
+	if err := store.Orders.CreateOrder(ctx, models.Order{OrderID: orderID, Status: "NEW", UserID: owner}); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	for _, userID := range []int64{owner, other} {
+		err := store.Orders.CreateOrder(ctx, models.Order{OrderID: orderID, Status: "NEW", UserID: userID})
+		if !errors.Is(err, storage.ErrConflict) {
+			t.Errorf("CreateOrder again by user %d: error = %v, want %v", userID, err, storage.ErrConflict)
+		}
+	}
+
+	order, err := store.Orders.GetOrder(ctx, orderID)
+	if err != nil || order.UserID != owner {
+		t.Errorf("GetOrder = %+v, %v; want owner %d", order, err, owner)
+	}
+}
+
+func testInsufficientFunds(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	userID := newUser(t, store)
+	fund(t, store, userID, 100)
+
+	overdraft := unique()
+	if err := withdraw(store, userID, overdraft, 150); !errors.Is(err, storage.ErrInsufficientFunds) {
+		t.Fatalf("withdraw 150 of 100: error = %v, want %v", err, storage.ErrInsufficientFunds)
+	}
+	if order, err := store.Orders.GetOrder(ctx, overdraft); err != nil || order.UserID != 0 {
+		t.Errorf("rejected withdrawal was kept: %+v, %v", order, err)
+	}
+
+	if err := withdraw(store, userID, unique(), 60); err != nil {
+		t.Fatalf("withdraw 60 of 100: %v", err)
+	}
+	if err := withdraw(store, userID, unique(), 60); !errors.Is(err, storage.ErrInsufficientFunds) {
+		t.Errorf("withdraw 60 of 40: error = %v, want %v", err, storage.ErrInsufficientFunds)
+	}
+
+	balance, err := store.Balance.GetUserBalance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Current != 40 || balance.Withdraw != 60 {
+		t.Errorf("balance = %+v, want current 40, withdrawn 60", *balance)
+	}
+}
+
+func testOrdersByUploadTime(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	userID := newUser(t, store)
+
+	var uploaded []string
+	for i := 0; i < 3; i++ {
+		orderID := unique()
+		if err := store.Orders.CreateOrder(ctx, models.Order{OrderID: orderID, Status: "NEW", UserID: userID}); err != nil {
+			t.Fatalf("CreateOrder: %v", err)
+		}
+		uploaded = append(uploaded, orderID)
+	}
+
+	orders, err := store.Orders.GetUserOrders(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUserOrders: %v", err)
+	}
+	if len(*orders) != len(uploaded) {
+		t.Fatalf("GetUserOrders returned %d orders, want %d", len(*orders), len(uploaded))
+	}
+	for i, order := range *orders {
+		if want := uploaded[len(uploaded)-1-i]; order.OrderID != want {
+			t.Errorf("order %d = %s, want %s: newest uploads come first", i, order.OrderID, want)
+		}
+		if i > 0 && order.UploadedAt.After((*orders)[i-1].UploadedAt) {
+			t.Errorf("order %d uploaded at %v, after the order before it", i, order.UploadedAt)
+		}
+	}
+}
+
+// testConcurrentWithdrawals races withdrawals that together exceed the
+// balance: no interleaving may overdraw it.
+func testConcurrentWithdrawals(t *testing.T, store *storage.Storage) {
+	const (
+		workers = 10
+		funds   = 100
+		sum     = 30
+	)
+	ctx := context.Background()
+	userID := newUser(t, store)
+	fund(t, store, userID, funds)
+
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = withdraw(store, userID, unique(), sum)
+		}()
+	}
+	wg.Wait()
+
+	var succeeded, aborted int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case isSerializationFailure(err):
+			// Retries ran out; the withdrawal was not applied.
+			aborted++
+		case !errors.Is(err, storage.ErrInsufficientFunds):
+			t.Errorf("withdraw: unexpected error %v", err)
+		}
+	}
+
+	possible := funds / sum
+	if succeeded > possible || (aborted == 0 && succeeded != possible) {
+		t.Errorf("%d withdrawals of %d succeeded against %d, want %d", succeeded, sum, funds, possible)
+	}
+
+	balance, err := store.Balance.GetUserBalance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Current < 0 || balance.Withdraw != float32(succeeded*sum) {
+		t.Errorf("balance = %+v after %d withdrawals of %d", *balance, succeeded, sum)
+	}
+}
+
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		(pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected)
+}
+
+// testTOTPEnrolment stores a sealed secret, which is longer than a plain
+// base32 one, and confirms the enrolment.
+func testTOTPEnrolment(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	userID := newUser(t, store)
+
+	totp, err := services.NewTOTPService("gophermart", "conformance-totp-key-0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := totp.SealSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := []string{services.HashRecoveryCode("recovery-1"), services.HashRecoveryCode("recovery-2")}
+	if err := store.TOTP.SaveTOTPSecret(ctx, userID, sealed, codes); err != nil {
+		t.Fatalf("SaveTOTPSecret: %v", err)
+	}
+	if err := store.TOTP.EnableTOTP(ctx, userID); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+
+	stored, err := store.TOTP.GetTOTP(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetTOTP: %v", err)
+	}
+	if stored.Secret != sealed || !stored.Enabled {
+		t.Fatalf("GetTOTP = %+v, want enabled with the sealed secret", *stored)
+	}
+	if opened, err := totp.OpenSecret(stored.Secret); err != nil || opened != secret {
+		t.Errorf("OpenSecret = %q, %v; want %q", opened, err, secret)
+	}
+
+	if err := store.TOTP.UseTOTPStep(ctx, userID, 100); err != nil {
+		t.Fatalf("UseTOTPStep: %v", err)
+	}
+	if err := store.TOTP.UseTOTPStep(ctx, userID, 100); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("UseTOTPStep of a used step: error = %v, want %v", err, storage.ErrConflict)
+	}
+	if err := store.TOTP.UseRecoveryCode(ctx, userID, codes[0]); err != nil {
+		t.Fatalf("UseRecoveryCode: %v", err)
+	}
+	if err := store.TOTP.UseRecoveryCode(ctx, userID, codes[0]); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UseRecoveryCode of a used code: error = %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func testEmptyBalance(t *testing.T, store *storage.Storage) {
+	balance, err := store.Balance.GetUserBalance(context.Background(), newUser(t, store))
+	if err != nil {
+		t.Fatalf("GetUserBalance: %v", err)
+	}
+	if balance.Current != 0 || balance.Withdraw != 0 {
+		t.Errorf("balance = %+v, want zero", *balance)
+	}
+}
+
+// testClaimPendingOrders checks that withdrawals are never polled and that a
+// polled order waits until everything else has had its turn.
+func testClaimPendingOrders(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	userID := newUser(t, store)
+	fund(t, store, userID, 100)
+
+	uploaded := unique()
+	if err := store.Orders.CreateOrder(ctx, models.Order{OrderID: uploaded, Status: "NEW", UserID: userID}); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if err := withdraw(store, userID, unique(), 10); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+
+	// Other tests leave pending orders behind, so only this user's count.
+	claim := func(polledBefore time.Time) []string {
+		t.Helper()
+		orders, err := store.Orders.ClaimPendingOrders(ctx, 1000, polledBefore)
+		if err != nil {
+			t.Fatalf("ClaimPendingOrders: %v", err)
+		}
+		var claimed []string
+		for _, order := range orders {
+			if order.UserID == userID {
+				claimed = append(claimed, order.OrderID)
+			}
+		}
+		return claimed
+	}
+
+	if claimed := claim(time.Now().Add(time.Hour)); len(claimed) != 1 || claimed[0] != uploaded {
+		t.Fatalf("first claim = %v, want only the upload %s", claimed, uploaded)
+	}
+	if claimed := claim(time.Now().Add(-time.Hour)); len(claimed) != 0 {
+		t.Errorf("claim of orders not polled for an hour = %v, want none", claimed)
+	}
+	if claimed := claim(time.Now().Add(time.Hour)); len(claimed) != 1 {
+		t.Errorf("claim after the repoll delay = %v, want the upload again", claimed)
+	}
+
+	if err := store.Orders.UpdateOrderStatus(ctx, uploaded, "PROCESSED", 5, models.OrderEventSourceAccrualPoll); err != nil {
+		t.Fatalf("UpdateOrderStatus: %v", err)
+	}
+	if claimed := claim(time.Now().Add(time.Hour)); len(claimed) != 0 {
+		t.Errorf("claim after the accrual became final = %v, want none", claimed)
+	}
+}
+
+// testNestedTx checks that a unit of work started inside a transaction joins
+// it: it sees the uncommitted writes, runs once whatever its options, and is
+// rolled back with the outer transaction.
+func testNestedTx(t *testing.T, store *storage.Storage) {
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	for _, outerErr := range []error{nil, errRollback} {
+		login, orderID := "user-"+unique(), unique()
+		var innerRuns int
+
+		err := store.Tx.WithinTx(ctx, storage.TxOptions{}, func(ctx context.Context, tx *storage.Storage) error {
+			userID, err := tx.Users.CreateUser(ctx, login, "Password123!x")
+			if err != nil {
+				return err
+			}
+			err = tx.Tx.WithinTx(ctx, withdrawTxOptions, func(ctx context.Context, inner *storage.Storage) error {
+				innerRuns++
+				if _, err := inner.Users.GetUserByUsername(ctx, login); err != nil {
+					return fmt.Errorf("user of the outer transaction: %w", err)
+				}
+				return inner.Orders.CreateOrder(ctx, models.Order{OrderID: orderID, Status: "NEW", UserID: userID})
+			})
+			if err != nil {
+				return err
+			}
+			return outerErr
+		})
+		if !errors.Is(err, outerErr) {
+			t.Fatalf("WithinTx error = %v, want %v", err, outerErr)
+		}
+		if innerRuns != 1 {
+			t.Errorf("nested unit of work ran %d times, want once", innerRuns)
+		}
+
+		_, userErr := store.Users.GetUserByUsername(ctx, login)
+		order, orderErr := store.Orders.GetOrder(ctx, orderID)
+		if orderErr != nil {
+			t.Fatalf("GetOrder: %v", orderErr)
+		}
+		if committed := outerErr == nil; (userErr == nil) != committed || (order.OrderID != "") != committed {
+			t.Errorf("outer error %v: user error = %v, order = %+v; want both committed = %v", outerErr, userErr, order, committed)
+		}
+	}
+}
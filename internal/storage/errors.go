@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrUnavailable = errors.New("storage unavailable")
+
+// IsUnavailable reports whether err means that the storage could not answer
+// in time or at all, as opposed to rejecting the operation. Callers should
+// treat such errors as temporary.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) ||
+		pgconn.Timeout(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgerrcode.QueryCanceled ||
+			pgErr.Code == pgerrcode.CannotConnectNow ||
+			pgErr.Code == pgerrcode.AdminShutdown ||
+			pgErr.Code == pgerrcode.TooManyConnections ||
+			pgerrcode.IsConnectionException(pgErr.Code)
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
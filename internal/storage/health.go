@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HealthChecker tells whether the backend is reachable and which schema
+// version it is at.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (int64, error)
+}
+
+type pgHealth struct {
+	pool *pgxpool.Pool
+}
+
+func (h *pgHealth) Ping(ctx context.Context) error {
+	return h.pool.Ping(ctx)
+}
+
+// SchemaVersion reads the version directly rather than through the migrator,
+// which would wait for the migration lock.
+func (h *pgHealth) SchemaVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := h.pool.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
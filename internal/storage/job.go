@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+// JobStorage keeps user jobs. Jobs are returned without their result, which
+// is only loaded by GetJobResult.
+type JobStorage interface {
+	CreateJob(ctx context.Context, job *models.Job) error
+	GetJob(ctx context.Context, jobID string) (*models.Job, error)
+	GetLatestJob(ctx context.Context, userID int64, kind string) (*models.Job, error)
+	GetJobResult(ctx context.Context, jobID string) ([]byte, error)
+	// ClaimJob marks the oldest pending job as running and returns it. Jobs
+	// left running since before staleBefore are picked up again.
+	ClaimJob(ctx context.Context, staleBefore time.Time) (*models.Job, error)
+	FinishJob(ctx context.Context, jobID, status, errorMessage string, result []byte) error
+	ClearJobResults(ctx context.Context, userID int64) error
+	DeleteJobsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type jobStorage struct {
+	db querier
+}
+
+const jobColumns = "id, user_id, kind, status, error, created_at, started_at, finished_at"
+
+func scanJob(row pgx.Row) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(&job.ID, &job.UserID, &job.Kind, &job.Status, &job.Error,
+		&job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (store *jobStorage) CreateJob(ctx context.Context, job *models.Job) error {
+	row := store.db.QueryRow(ctx,
+		"INSERT INTO user_jobs (id, user_id, kind, status) VALUES ($1, $2, $3, $4) RETURNING created_at",
+		job.ID, job.UserID, job.Kind, job.Status)
+
+	return row.Scan(&job.CreatedAt)
+}
+
+func (store *jobStorage) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
+	return scanJob(store.db.QueryRow(ctx,
+		"SELECT "+jobColumns+" FROM user_jobs WHERE id = $1", jobID))
+}
+
+func (store *jobStorage) GetLatestJob(ctx context.Context, userID int64, kind string) (*models.Job, error) {
+	return scanJob(store.db.QueryRow(ctx,
+		"SELECT "+jobColumns+" FROM user_jobs WHERE user_id = $1 AND kind = $2 ORDER BY created_at DESC LIMIT 1",
+		userID, kind))
+}
+
+func (store *jobStorage) GetJobResult(ctx context.Context, jobID string) ([]byte, error) {
+	var result []byte
+	err := store.db.QueryRow(ctx, "SELECT result FROM user_jobs WHERE id = $1", jobID).Scan(&result)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *jobStorage) ClaimJob(ctx context.Context, staleBefore time.Time) (*models.Job, error) {
+	return scanJob(store.db.QueryRow(ctx,
+		`UPDATE user_jobs SET status = $1, started_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM user_jobs
+			WHERE status = $2 OR (status = $1 AND started_at < $3)
+			ORDER BY created_at LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		models.JobStatusRunning, models.JobStatusPending, staleBefore))
+}
+
+func (store *jobStorage) FinishJob(ctx context.Context, jobID, status, errorMessage string, result []byte) error {
+	_, err := store.db.Exec(ctx,
+		"UPDATE user_jobs SET status = $2, error = $3, result = $4, finished_at = CURRENT_TIMESTAMP WHERE id = $1",
+		jobID, status, errorMessage, result)
+	return err
+}
+
+func (store *jobStorage) ClearJobResults(ctx context.Context, userID int64) error {
+	_, err := store.db.Exec(ctx, "UPDATE user_jobs SET result = NULL WHERE user_id = $1", userID)
+	return err
+}
+
+// DeleteJobsBefore deletes jobs that finished before the given time.
+func (store *jobStorage) DeleteJobsBefore(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := store.db.Exec(ctx, "DELETE FROM user_jobs WHERE finished_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
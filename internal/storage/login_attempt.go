@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+type LoginAttemptStorage interface {
+	GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error)
+	RegisterLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+type loginAttemptStorage struct {
+	db querier
+}
+
+func NewLoginAttemptStorage(dbPool *pgxpool.Pool) LoginAttemptStorage {
+	return &loginAttemptStorage{
+		db: dbPool,
+	}
+}
+
+func (store *loginAttemptStorage) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	attempt := models.LoginAttempt{Key: key}
+
+	row := store.db.QueryRow(ctx,
+		"SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1", key)
+
+	err := row.Scan(&attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &attempt, nil
+		}
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// RegisterLoginFailure increments the failure counter for key and returns the
+// new value. Counters whose last failure is older than window start over.
+func (store *loginAttemptStorage) RegisterLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	row := store.db.QueryRow(ctx,
+		`INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`,
+		key, now, now.Add(-window))
+
+	var failures int
+	if err := row.Scan(&failures); err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (store *loginAttemptStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := store.db.Exec(ctx,
+		"UPDATE login_attempts SET locked_until = $2 WHERE key = $1", key, until)
+	return err
+}
+
+func (store *loginAttemptStorage) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := store.db.Exec(ctx,
+		"DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
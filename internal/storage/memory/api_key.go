@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+func (s *Store) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.apiKeys {
+		if existing.keyHash == keyHash {
+			return storage.ErrConflict
+		}
+	}
+
+	s.lastAPIKeyID++
+	key.ID = s.lastAPIKeyID
+	key.CreatedAt = time.Now()
+
+	stored := *key
+	stored.Scopes = append([]string(nil), key.Scopes...)
+	s.apiKeys[key.ID] = &apiKey{APIKey: stored, keyHash: keyHash}
+	return nil
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []models.APIKey
+	for _, key := range s.apiKeys {
+		if key.UserID == userID && !key.revoked {
+			keys = append(keys, key.APIKey)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID > keys[j].ID
+	})
+
+	return keys, nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[keyID]
+	if !ok || key.UserID != userID || key.revoked {
+		return storage.ErrNotFound
+	}
+
+	key.revoked = true
+	return nil
+}
+
+func (s *Store) RevokeAllAPIKeys(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			key.revoked = true
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.apiKeys {
+		if key.keyHash == keyHash && !key.revoked {
+			copied := key.APIKey
+			return &copied, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *Store) TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.apiKeys[keyID]; ok {
+		key.LastUsedAt = &usedAt
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+func (s *Store) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAuditID++
+	event.ID = s.lastAuditID
+	event.CreatedAt = time.Now()
+
+	stored := *event
+	stored.Details = maps.Clone(event.Details)
+	s.auditEvents = append(s.auditEvents, stored)
+	return nil
+}
+
+func (s *Store) ListAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []models.AuditEvent
+	for i := len(s.auditEvents) - 1; i >= 0 && len(events) < query.Limit; i-- {
+		event := s.auditEvents[i]
+		switch {
+		case query.UserID != 0 && event.UserID != query.UserID:
+		case query.Type != "" && event.Type != query.Type:
+		case !query.From.IsZero() && event.CreatedAt.Before(query.From):
+		case !query.To.IsZero() && !event.CreatedAt.Before(query.To):
+		case query.BeforeID != 0 && event.ID >= query.BeforeID:
+		default:
+			event.Details = maps.Clone(event.Details)
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *Store) DeleteAuditEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.auditEvents[:0]
+	for _, event := range s.auditEvents {
+		if !event.CreatedAt.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+
+	deleted := int64(len(s.auditEvents) - len(kept))
+	s.auditEvents = kept
+	return deleted, nil
+}
+
+func (s *Store) PseudonymizeAuditEvents(ctx context.Context, userID int64, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.auditEvents {
+		event := &s.auditEvents[i]
+		if event.UserID != userID && event.Details["login"] != login {
+			continue
+		}
+		event.IP = ""
+		event.UserAgent = ""
+		delete(event.Details, "login")
+	}
+	return nil
+}
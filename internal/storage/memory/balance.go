@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+func (s *Store) GetUserBalance(ctx context.Context, userID int64) (*models.UserBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userBalance models.UserBalance
+	for _, o := range s.orders {
+		if o.UserID == userID {
+			userBalance.Current += o.Accrual - o.Withdrawn
+			userBalance.Withdraw += o.Withdrawn
+		}
+	}
+
+	return &userBalance, nil
+}
+
+func (s *Store) CheckBalanceWithdrawal(ctx context.Context, userID int64, amount float32) error {
+	userBalance, err := s.GetUserBalance(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if userBalance.Current < 0 {
+		return storage.ErrInsufficientFunds
+	}
+
+	return nil
+}
+
+func (s *Store) GetWithdrawalsByUserID(ctx context.Context, userID int64) (*[]models.UserWithdrawal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userWithdrawals []models.UserWithdrawal
+	for _, o := range s.userOrders(userID) {
+		userWithdrawals = append(userWithdrawals, models.UserWithdrawal{
+			OrderNumber: o.OrderID,
+			Withdrawn:   o.Withdrawn,
+			UploadedAt:  o.uploadedAt,
+		})
+	}
+
+	return &userWithdrawals, nil
+}
@@ -0,0 +1,12 @@
+package memory
+
+import "context"
+
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// SchemaVersion is always 0: the in-memory store has no schema.
+func (s *Store) SchemaVersion(ctx context.Context) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+// jobCopy returns a job without its result.
+func jobCopy(job *models.Job) *models.Job {
+	copied := *job
+	copied.Result = nil
+	return &copied
+}
+
+func (s *Store) CreateJob(ctx context.Context, job *models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; ok {
+		return storage.ErrConflict
+	}
+
+	job.CreatedAt = time.Now()
+	s.jobs[job.ID] = jobCopy(job)
+	return nil
+}
+
+func (s *Store) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return jobCopy(job), nil
+}
+
+func (s *Store) GetLatestJob(ctx context.Context, userID int64, kind string) (*models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var latest *models.Job
+	for _, job := range s.jobs {
+		if job.UserID == userID && job.Kind == kind &&
+			(latest == nil || job.CreatedAt.After(latest.CreatedAt)) {
+			latest = job
+		}
+	}
+	if latest == nil {
+		return nil, storage.ErrNotFound
+	}
+	return jobCopy(latest), nil
+}
+
+func (s *Store) GetJobResult(ctx context.Context, jobID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return job.Result, nil
+}
+
+func (s *Store) ClaimJob(ctx context.Context, staleBefore time.Time) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next *models.Job
+	for _, job := range s.jobs {
+		claimable := job.Status == models.JobStatusPending ||
+			(job.Status == models.JobStatusRunning && job.StartedAt.Before(staleBefore))
+		if claimable && (next == nil || job.CreatedAt.Before(next.CreatedAt)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	startedAt := time.Now()
+	next.Status = models.JobStatusRunning
+	next.StartedAt = &startedAt
+	return jobCopy(next), nil
+}
+
+func (s *Store) FinishJob(ctx context.Context, jobID, status, errorMessage string, result []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil
+	}
+
+	finishedAt := time.Now()
+	job.Status = status
+	job.Error = errorMessage
+	job.Result = result
+	job.FinishedAt = &finishedAt
+	return nil
+}
+
+func (s *Store) ClearJobResults(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.UserID == userID {
+			job.Result = nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteJobsBefore(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(before) {
+			delete(s.jobs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+func (s *Store) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attempt, ok := s.loginAttempts[key]
+	if !ok {
+		return &models.LoginAttempt{Key: key}, nil
+	}
+
+	copied := *attempt
+	return &copied, nil
+}
+
+func (s *Store) RegisterLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.loginAttempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key}
+		s.loginAttempts[key] = attempt
+	}
+
+	if attempt.LastFailureAt.Before(now.Add(-window)) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+
+	return attempt.Failures, nil
+}
+
+func (s *Store) LockLogin(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempt, ok := s.loginAttempts[key]; ok {
+		attempt.LockedUntil = until
+	}
+	return nil
+}
+
+func (s *Store) ResetLoginAttempts(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginAttempts, key)
+	return nil
+}
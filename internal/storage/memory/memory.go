@@ -0,0 +1,164 @@
+// Package memory keeps all data in process memory. It mirrors the semantics
+// of the PostgreSQL storage and is meant for tests and local demos.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type order struct {
+	models.Order
+	uploadedAt time.Time
+	polledAt   time.Time
+	seq        int64
+	events     []models.OrderEvent
+}
+
+type totp struct {
+	models.TOTP
+	recoveryCodes map[string]struct{}
+}
+
+type apiKey struct {
+	models.APIKey
+	keyHash string
+	revoked bool
+}
+
+type Store struct {
+	mu   sync.RWMutex
+	auth services.AuthService
+
+	users      map[int64]*models.User
+	oidc       map[[2]string]int64
+	admins     map[int64]struct{}
+	lastUserID int64
+
+	orders   map[string]*order
+	orderSeq int64
+
+	loginAttempts map[string]*models.LoginAttempt
+	totp          map[int64]*totp
+
+	apiKeys      map[int64]*apiKey
+	lastAPIKeyID int64
+
+	auditEvents []models.AuditEvent
+	lastAuditID int64
+
+	jobs map[string]*models.Job
+}
+
+func NewStore(auth services.AuthService) *Store {
+	return &Store{
+		auth:          auth,
+		users:         make(map[int64]*models.User),
+		oidc:          make(map[[2]string]int64),
+		admins:        make(map[int64]struct{}),
+		orders:        make(map[string]*order),
+		loginAttempts: make(map[string]*models.LoginAttempt),
+		totp:          make(map[int64]*totp),
+		apiKeys:       make(map[int64]*apiKey),
+		jobs:          make(map[string]*models.Job),
+	}
+}
+
+// New returns a storage bundle backed by a single in-memory store.
+func New(auth services.AuthService) *storage.Storage {
+	store := NewStore(auth)
+
+	bundle := store.bundle()
+	bundle.Tx = store
+	bundle.Health = store
+	return bundle
+}
+
+func (s *Store) bundle() *storage.Storage {
+	return &storage.Storage{
+		Users:         s,
+		Orders:        s,
+		Balance:       s,
+		LoginAttempts: s,
+		TOTP:          s,
+		APIKeys:       s,
+		Audit:         s,
+		Jobs:          s,
+	}
+}
+
+// WithinTx runs fn against a copy of the data while holding the store lock,
+// and publishes the copy only if fn succeeds. Units of work are therefore
+// serializable whatever the requested isolation level.
+func (s *Store) WithinTx(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context, tx *storage.Storage) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.clone()
+	if err := fn(ctx, storage.JoinTx(tx.bundle())); err != nil {
+		return err
+	}
+
+	s.users, s.oidc, s.admins, s.lastUserID = tx.users, tx.oidc, tx.admins, tx.lastUserID
+	s.orders, s.orderSeq = tx.orders, tx.orderSeq
+	s.loginAttempts, s.totp = tx.loginAttempts, tx.totp
+	s.apiKeys, s.lastAPIKeyID = tx.apiKeys, tx.lastAPIKeyID
+	s.auditEvents, s.lastAuditID = tx.auditEvents, tx.lastAuditID
+	s.jobs = tx.jobs
+	return nil
+}
+
+// clone deep-copies the data so that it can be changed without affecting s.
+// The caller must hold s.mu.
+func (s *Store) clone() *Store {
+	c := NewStore(s.auth)
+	c.lastUserID = s.lastUserID
+	c.orderSeq = s.orderSeq
+	c.lastAPIKeyID = s.lastAPIKeyID
+	c.lastAuditID = s.lastAuditID
+	c.auditEvents = slices.Clone(s.auditEvents)
+
+	for id, user := range s.users {
+		copied := *user
+		c.users[id] = &copied
+	}
+	for subject, id := range s.oidc {
+		c.oidc[subject] = id
+	}
+	for id := range s.admins {
+		c.admins[id] = struct{}{}
+	}
+	for id, o := range s.orders {
+		copied := *o
+		copied.events = slices.Clone(o.events)
+		c.orders[id] = &copied
+	}
+	for key, attempt := range s.loginAttempts {
+		copied := *attempt
+		c.loginAttempts[key] = &copied
+	}
+	for id, t := range s.totp {
+		copied := *t
+		copied.recoveryCodes = make(map[string]struct{}, len(t.recoveryCodes))
+		for code := range t.recoveryCodes {
+			copied.recoveryCodes[code] = struct{}{}
+		}
+		c.totp[id] = &copied
+	}
+	for id, key := range s.apiKeys {
+		copied := *key
+		c.apiKeys[id] = &copied
+	}
+	for id, job := range s.jobs {
+		copied := *job
+		c.jobs[id] = &copied
+	}
+
+	return c
+}
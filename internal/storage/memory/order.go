@@ -0,0 +1,235 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+var orderStatuses = []string{"NEW", "PROCESSING", "INVALID", "PROCESSED"}
+
+func (s *Store) CreateOrder(ctx context.Context, o models.Order) error {
+	if !slices.Contains(orderStatuses, o.Status) {
+		return fmt.Errorf("invalid order status %q", o.Status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[o.OrderID]; ok {
+		return storage.ErrConflict
+	}
+	if _, ok := s.users[o.UserID]; !ok {
+		return fmt.Errorf("user %d does not exist", o.UserID)
+	}
+
+	now := time.Now()
+	s.orderSeq++
+	s.orders[o.OrderID] = &order{
+		Order:      o,
+		uploadedAt: now,
+		seq:        s.orderSeq,
+		events: []models.OrderEvent{{
+			Status:    o.Status,
+			Accrual:   o.Accrual,
+			Source:    models.OrderEventSourceUpload,
+			CreatedAt: now,
+		}},
+	}
+	return nil
+}
+
+func (s *Store) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return &models.Order{}, nil
+	}
+
+	return &models.Order{OrderID: o.OrderID, UserID: o.UserID}, nil
+}
+
+// userOrders returns the orders of a user, most recently uploaded first.
+func (s *Store) userOrders(userID int64) []*order {
+	var orders []*order
+	for _, o := range s.orders {
+		if o.UserID == userID {
+			orders = append(orders, o)
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].uploadedAt.Equal(orders[j].uploadedAt) {
+			return orders[i].uploadedAt.After(orders[j].uploadedAt)
+		}
+		return orders[i].seq > orders[j].seq
+	})
+
+	return orders
+}
+
+func (s *Store) GetUserOrders(ctx context.Context, userID int64) (*[]models.OrderResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var orders []models.OrderResponse
+	for _, o := range s.userOrders(userID) {
+		orders = append(orders, models.OrderResponse{
+			OrderID:    o.OrderID,
+			Status:     o.Status,
+			Accrual:    o.Accrual,
+			UploadedAt: o.uploadedAt,
+		})
+	}
+
+	return &orders, nil
+}
+
+func (s *Store) ListUserOrders(ctx context.Context, userID int64, query models.OrderQuery) ([]models.OrderResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// precedes reports whether (t1, id1) comes before (t2, id2) in the
+	// requested order.
+	precedes := func(t1 time.Time, id1 string, t2 time.Time, id2 string) bool {
+		if !t1.Equal(t2) {
+			return t1.Before(t2) == query.Ascending
+		}
+		return id1 != id2 && (id1 < id2) == query.Ascending
+	}
+
+	var selected []*order
+	for _, o := range s.orders {
+		switch {
+		case o.UserID != userID:
+		case len(query.Statuses) > 0 && !slices.Contains(query.Statuses, o.Status):
+		case !query.From.IsZero() && o.uploadedAt.Before(query.From):
+		case !query.To.IsZero() && !o.uploadedAt.Before(query.To):
+		case query.After != nil && !precedes(query.After.UploadedAt, query.After.OrderID, o.uploadedAt, o.OrderID):
+		default:
+			selected = append(selected, o)
+		}
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return precedes(selected[i].uploadedAt, selected[i].OrderID, selected[j].uploadedAt, selected[j].OrderID)
+	})
+
+	var orders []models.OrderResponse
+	for _, o := range selected {
+		if len(orders) == query.Limit {
+			break
+		}
+		orders = append(orders, models.OrderResponse{
+			OrderID:    o.OrderID,
+			Status:     o.Status,
+			Accrual:    o.Accrual,
+			UploadedAt: o.uploadedAt,
+		})
+	}
+
+	return orders, nil
+}
+
+func (s *Store) GetUserOrder(ctx context.Context, userID int64, orderID string) (*models.OrderTimeline, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.UserID != userID {
+		return nil, storage.ErrNotFound
+	}
+
+	return &models.OrderTimeline{
+		OrderResponse: models.OrderResponse{
+			OrderID:    o.OrderID,
+			Status:     o.Status,
+			Accrual:    o.Accrual,
+			Withdrawn:  o.Withdrawn,
+			UploadedAt: o.uploadedAt,
+		},
+		Events: slices.Clone(o.events),
+	}, nil
+}
+
+func (s *Store) CountPendingOrders(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, o := range s.orders {
+		if o.pending() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// pending reports whether the order is an upload whose accrual is not final
+// yet. Withdrawals are orders too, but are never accrued.
+func (o *order) pending() bool {
+	return (o.Status == "NEW" || o.Status == "PROCESSING") && o.Withdrawn == 0
+}
+
+func (s *Store) ClaimPendingOrders(ctx context.Context, limit int, polledBefore time.Time) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []*order
+	for _, o := range s.orders {
+		if o.pending() && o.polledAt.Before(polledBefore) {
+			pending = append(pending, o)
+		}
+	}
+
+	// Never polled orders have the zero time and come first.
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].polledAt.Equal(pending[j].polledAt) {
+			return pending[i].polledAt.Before(pending[j].polledAt)
+		}
+		return pending[i].seq < pending[j].seq
+	})
+
+	now := time.Now()
+	var orders []models.Order
+	for _, o := range pending {
+		if len(orders) == limit {
+			break
+		}
+		o.polledAt = now
+		orders = append(orders, models.Order{OrderID: o.OrderID, Status: o.Status, UserID: o.UserID})
+	}
+
+	return orders, nil
+}
+
+func (s *Store) UpdateOrderStatus(ctx context.Context, orderID, status string, accrual float32, source string) error {
+	if !slices.Contains(orderStatuses, status) {
+		return fmt.Errorf("invalid order status %q", status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[orderID]
+	if !ok || (o.Status == status && o.Accrual == accrual) {
+		return nil
+	}
+
+	o.Status = status
+	o.Accrual = accrual
+	o.events = append(o.events, models.OrderEvent{
+		Status:    status,
+		Accrual:   accrual,
+		Source:    source,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
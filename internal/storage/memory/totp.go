@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+func (s *Store) SaveTOTPSecret(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recoveryCodes := make(map[string]struct{}, len(recoveryCodeHashes))
+	for _, codeHash := range recoveryCodeHashes {
+		recoveryCodes[codeHash] = struct{}{}
+	}
+
+	s.totp[userID] = &totp{
+		TOTP:          models.TOTP{UserID: userID, Secret: secret},
+		recoveryCodes: recoveryCodes,
+	}
+	return nil
+}
+
+func (s *Store) GetTOTP(ctx context.Context, userID int64) (*models.TOTP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.totp[userID]
+	if !ok {
+		return &models.TOTP{UserID: userID}, nil
+	}
+
+	copied := t.TOTP
+	return &copied, nil
+}
+
+func (s *Store) EnableTOTP(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	t.Enabled = true
+	return nil
+}
+
+func (s *Store) DisableTOTP(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, userID)
+	return nil
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok || t.LastStep >= step {
+		return storage.ErrConflict
+	}
+
+	t.LastStep = step
+	return nil
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if _, ok := t.recoveryCodes[codeHash]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(t.recoveryCodes, codeHash)
+	return nil
+}
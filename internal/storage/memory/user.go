@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+func (s *Store) userByUsername(username string) *models.User {
+	for _, user := range s.users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *Store) insertUser(username, hashedPassword string) int64 {
+	s.lastUserID++
+	s.users[s.lastUserID] = &models.User{
+		ID:       s.lastUserID,
+		Username: username,
+		Password: hashedPassword,
+	}
+	return s.lastUserID
+}
+
+func (s *Store) CreateUser(ctx context.Context, username, password string) (int64, error) {
+	hashedPassword, err := s.auth.HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByUsername(username) != nil {
+		return 0, storage.ErrConflict
+	}
+
+	return s.insertUser(username, hashedPassword), nil
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user := s.userByUsername(username)
+	if user == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (s *Store) GetUserByID(ctx context.Context, userID int64) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (s *Store) GetTokenVersion(ctx context.Context, userID int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+
+	return user.TokenVersion, nil
+}
+
+func (s *Store) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+
+	user.Password = hashedPassword
+	user.TokenVersion++
+	return user.TokenVersion, nil
+}
+
+func (s *Store) UpdatePasswordHash(ctx context.Context, userID int64, hashedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[userID]; ok {
+		user.Password = hashedPassword
+	}
+	return nil
+}
+
+func (s *Store) GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userID, ok := s.oidc[[2]string{issuer, subject}]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	copied := *s.users[userID]
+	return &copied, nil
+}
+
+func (s *Store) CreateOIDCUser(ctx context.Context, username, issuer, subject string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity := [2]string{issuer, subject}
+	if _, ok := s.oidc[identity]; ok || s.userByUsername(username) != nil {
+		return 0, storage.ErrConflict
+	}
+
+	userID := s.insertUser(username, storage.UnusablePassword)
+	s.oidc[identity] = userID
+	return userID, nil
+}
+
+func (s *Store) LinkOIDCSubject(ctx context.Context, userID int64, issuer, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity := [2]string{issuer, subject}
+	if owner, ok := s.oidc[identity]; ok && owner != userID {
+		return storage.ErrConflict
+	}
+
+	for linked, owner := range s.oidc {
+		if owner == userID {
+			delete(s.oidc, linked)
+		}
+	}
+	s.oidc[identity] = userID
+	return nil
+}
+
+func (s *Store) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return false, storage.ErrNotFound
+	}
+
+	_, ok := s.admins[userID]
+	return ok, nil
+}
+
+func (s *Store) SetAdmin(ctx context.Context, userID int64, admin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return storage.ErrNotFound
+	}
+
+	if admin {
+		s.admins[userID] = struct{}{}
+	} else {
+		delete(s.admins, userID)
+	}
+	return nil
+}
+
+func (s *Store) AnonymizeUser(ctx context.Context, userID int64, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if existing := s.userByUsername(username); existing != nil && existing.ID != userID {
+		return storage.ErrConflict
+	}
+
+	for identity, owner := range s.oidc {
+		if owner == userID {
+			delete(s.oidc, identity)
+		}
+	}
+	delete(s.admins, userID)
+
+	user.Username = username
+	user.Password = storage.UnusablePassword
+	user.TokenVersion++
+	return nil
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
@@ -14,13 +18,22 @@ import (
 )
 
 type OrderStorage interface {
-	CreateOrder(order models.Order) error
-	GetOrder(orderID string) *models.Order
+	CreateOrder(ctx context.Context, order models.Order) error
+	GetOrder(ctx context.Context, orderID string) (*models.Order, error)
 	GetUserOrders(ctx context.Context, userID int64) (*[]models.OrderResponse, error)
+	ListUserOrders(ctx context.Context, userID int64, query models.OrderQuery) ([]models.OrderResponse, error)
+	GetUserOrder(ctx context.Context, userID int64, orderID string) (*models.OrderTimeline, error)
+	// ClaimPendingOrders returns up to limit uploaded orders whose accrual is
+	// not final and that were not polled since polledBefore, least recently
+	// polled first, and marks them as polled now.
+	ClaimPendingOrders(ctx context.Context, limit int, polledBefore time.Time) ([]models.Order, error)
+	CountPendingOrders(ctx context.Context) (int64, error)
+	UpdateOrderStatus(ctx context.Context, orderID, status string, accrual float32, source string) error
 }
 
 type orderStorage struct {
-	db *pgxpool.Pool
+	db      querier
+	replica *readReplica
 }
 
 func NewOrderStorage(dbPool *pgxpool.Pool) OrderStorage {
@@ -29,14 +42,20 @@ func NewOrderStorage(dbPool *pgxpool.Pool) OrderStorage {
 	}
 }
 
-func (store *orderStorage) CreateOrder(order models.Order) error {
+func (store *orderStorage) CreateOrder(ctx context.Context, order models.Order) error {
 	if store.db == nil {
 		return fmt.Errorf("database connection is not initialized")
 	}
 
-	row := store.db.QueryRow(context.Background(),
-		"INSERT INTO orders (id, status, accrual, withdrawn, user_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
-		order.OrderID, order.Status, order.Accrual, order.Withdrawn, order.UserID)
+	row := store.db.QueryRow(ctx,
+		`WITH inserted AS (
+			INSERT INTO orders (id, status, accrual, withdrawn, user_id) VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, status, accrual
+		)
+		INSERT INTO order_events (order_id, status, accrual, source)
+		SELECT id, status, accrual, $6 FROM inserted
+		RETURNING order_id`,
+		order.OrderID, order.Status, order.Accrual, order.Withdrawn, order.UserID, models.OrderEventSourceUpload)
 
 	var number string
 	err := row.Scan(&number)
@@ -47,32 +66,32 @@ func (store *orderStorage) CreateOrder(order models.Order) error {
 		}
 		return err
 	}
-	logger.Log.Info("Order created successfully", "order", order)
+	logger.Log.InfoContext(ctx, "Order created successfully", "order", order)
 	return nil
 }
 
-func (store *orderStorage) GetOrder(orderID string) *models.Order {
+// GetOrder returns the owner of an order. An unknown order yields an empty
+// Order rather than an error.
+func (store *orderStorage) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
 	var order models.Order
 
-	row := store.db.QueryRow(context.Background(),
+	row := store.db.QueryRow(ctx,
 		"SELECT id, user_id FROM orders WHERE id = $1", orderID)
 
 	err := row.Scan(&order.OrderID, &order.UserID)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.NoData {
-			logger.Log.Warn("Order not found", "orderID", orderID)
-			return &order
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &order, nil
 		}
-		logger.Log.Error("Error while scanning row", "error", err)
-		return &order
+		logger.Log.ErrorContext(ctx, "Error while scanning row", "error", err)
+		return nil, err
 	}
 
-	return &order
+	return &order, nil
 }
 
 func (store *orderStorage) GetUserOrders(ctx context.Context, userID int64) (*[]models.OrderResponse, error) {
-	rows, err := store.db.Query(ctx,
+	rows, err := store.replica.Query(ctx, store.db,
 		"SELECT id, status, accrual, uploaded_at FROM orders WHERE user_id = $1 ORDER BY uploaded_at DESC", userID)
 	if err != nil {
 		return nil, err
@@ -83,17 +102,154 @@ func (store *orderStorage) GetUserOrders(ctx context.Context, userID int64) (*[]
 	for rows.Next() {
 		var order models.OrderResponse
 		if err := rows.Scan(&order.OrderID, &order.Status, &order.Accrual, &order.UploadedAt); err != nil {
-			logger.Log.Error("Error while scanning row", "error", err)
+			logger.Log.ErrorContext(ctx, "Error while scanning row", "error", err)
 			return nil, err
 		}
 		orders = append(orders, order)
 	}
-	logger.Log.Info("User orders retrieved successfully", "orders", orders)
+	logger.Log.InfoContext(ctx, "User orders retrieved successfully", "orders", orders)
 
 	if err := rows.Err(); err != nil {
-		logger.Log.Error("GetUserOrders: Error while scanning rows", "error", err)
+		logger.Log.ErrorContext(ctx, "GetUserOrders: Error while scanning rows", "error", err)
 		return nil, err
 	}
 
 	return &orders, nil
 }
+
+// ListUserOrders returns one page of the user's orders, keyed on
+// (uploaded_at, id) so that deep pages cost as much as the first one.
+func (store *orderStorage) ListUserOrders(ctx context.Context, userID int64, query models.OrderQuery) ([]models.OrderResponse, error) {
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(query.Statuses) > 0 {
+		conditions = append(conditions, "status = ANY("+arg(query.Statuses)+")")
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "uploaded_at >= "+arg(query.From))
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "uploaded_at < "+arg(query.To))
+	}
+
+	direction, compare := "DESC", "<"
+	if query.Ascending {
+		direction, compare = "ASC", ">"
+	}
+	if query.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(uploaded_at, id) %s (%s, %s)",
+			compare, arg(query.After.UploadedAt), arg(query.After.OrderID)))
+	}
+
+	rows, err := store.replica.Query(ctx, store.db, fmt.Sprintf(
+		"SELECT id, status, accrual, uploaded_at FROM orders WHERE %s ORDER BY uploaded_at %s, id %s LIMIT %s",
+		strings.Join(conditions, " AND "), direction, direction, arg(query.Limit)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.OrderResponse
+	for rows.Next() {
+		var order models.OrderResponse
+		if err := rows.Scan(&order.OrderID, &order.Status, &order.Accrual, &order.UploadedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// GetUserOrder returns an order of the user with its events, oldest first.
+func (store *orderStorage) GetUserOrder(ctx context.Context, userID int64, orderID string) (*models.OrderTimeline, error) {
+	var timeline models.OrderTimeline
+
+	row := store.db.QueryRow(ctx,
+		"SELECT id, status, accrual, withdrawn, uploaded_at FROM orders WHERE id = $1 AND user_id = $2", orderID, userID)
+
+	err := row.Scan(&timeline.OrderID, &timeline.Status, &timeline.Accrual, &timeline.Withdrawn, &timeline.UploadedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := store.db.Query(ctx,
+		"SELECT status, accrual, source, created_at FROM order_events WHERE order_id = $1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeline.Events = []models.OrderEvent{}
+	for rows.Next() {
+		var event models.OrderEvent
+		if err := rows.Scan(&event.Status, &event.Accrual, &event.Source, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		timeline.Events = append(timeline.Events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &timeline, nil
+}
+
+// pendingOrder selects uploaded orders whose accrual is not final yet.
+// Withdrawals are orders too, but are never accrued.
+const pendingOrder = "status IN ('NEW', 'PROCESSING') AND withdrawn = 0"
+
+func (store *orderStorage) ClaimPendingOrders(ctx context.Context, limit int, polledBefore time.Time) ([]models.Order, error) {
+	rows, err := store.db.Query(ctx,
+		`UPDATE orders SET polled_at = CURRENT_TIMESTAMP WHERE id IN (
+			SELECT id FROM orders WHERE `+pendingOrder+` AND (polled_at IS NULL OR polled_at < $1)
+			ORDER BY polled_at NULLS FIRST, uploaded_at LIMIT $2 FOR UPDATE SKIP LOCKED)
+		RETURNING id, status, user_id`,
+		polledBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(&order.OrderID, &order.Status, &order.UserID); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+func (store *orderStorage) CountPendingOrders(ctx context.Context) (int64, error) {
+	var count int64
+	err := store.db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM orders WHERE "+pendingOrder).Scan(&count)
+	return count, err
+}
+
+// UpdateOrderStatus sets the status and accrual of an order and records the
+// change as an event from source. Nothing is recorded if neither changed.
+func (store *orderStorage) UpdateOrderStatus(ctx context.Context, orderID, status string, accrual float32, source string) error {
+	_, err := store.db.Exec(ctx,
+		`WITH updated AS (
+			UPDATE orders SET status = $2, accrual = $3
+			WHERE id = $1 AND (status IS DISTINCT FROM $2 OR accrual IS DISTINCT FROM $3)
+			RETURNING id, status, accrual
+		)
+		INSERT INTO order_events (order_id, status, accrual, source)
+		SELECT id, status, accrual, $4 FROM updated`,
+		orderID, status, accrual, source)
+	return err
+}
@@ -0,0 +1,339 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the pg_advisory_lock key held while migrations run, so
+// that concurrently starting instances apply them only once.
+const migrationLockID int64 = 7_305_112_404
+
+var ErrSchemaVersion = errors.New("unexpected schema version")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations reads the embedded NNNN_name.up.sql / NNNN_name.down.sql
+// pairs, ordered by version.
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("malformed migration file name %q", name)
+		}
+
+		versionPart, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("malformed migration file name %q", name)
+		}
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed migration version in %q: %w", name, err)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	dryRun     bool
+	out        io.Writer
+}
+
+// NewMigrator returns a migrator over the embedded migrations. In dry-run mode
+// the SQL that would run is written to out instead of being executed.
+func NewMigrator(pool *pgxpool.Pool, dryRun bool, out io.Writer) (*Migrator, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		pool:       pool,
+		migrations: migrations,
+		dryRun:     dryRun,
+		out:        out,
+	}, nil
+}
+
+// LatestVersion is the schema version this binary expects.
+func (m *Migrator) LatestVersion() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// queryer is implemented by both *pgxpool.Pool and *pgxpool.Conn, so that
+// the applied versions can be read with or without the migration lock.
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// tableExists reports whether schema_migrations has been created, which it is
+// not on a fresh database until the first migration run.
+func (m *Migrator) tableExists(ctx context.Context, q queryer) (bool, error) {
+	var exists bool
+	err := q.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	return exists, err
+}
+
+func (m *Migrator) applied(ctx context.Context, q queryer) (map[int64]time.Time, error) {
+	applied := make(map[int64]time.Time)
+
+	exists, err := m.tableExists(ctx, q)
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := q.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory
+// lock. A dry run writes nothing, so it neither takes the lock nor creates
+// schema_migrations.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if m.dryRun {
+		return fn(conn)
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, migration Migration, up bool) error {
+	script, direction := migration.Up, "up"
+	if !up {
+		script, direction = migration.Down, "down"
+	}
+
+	if m.dryRun {
+		fmt.Fprintf(m.out, "-- %04d_%s (%s)\n%s\n", migration.Version, migration.Name, direction, script)
+		return nil
+	}
+
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return fmt.Errorf("migration %d %s failed: %w", migration.Version, direction, err)
+		}
+
+		var err error
+		if up {
+			_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+				migration.Version, migration.Name)
+		} else {
+			_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(m.out, "%s %04d_%s\n", direction, migration.Version, migration.Name)
+		return nil
+	})
+}
+
+// Up applies pending migrations up to and including target. A zero target
+// means the latest version.
+func (m *Migrator) Up(ctx context.Context, target int64) error {
+	if target == 0 {
+		target = m.LatestVersion()
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > target {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the given number of most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d cannot be reverted", migration.Version)
+			}
+			if err := m.run(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status lists every migration and when it was applied. Like Version, it
+// reads without the migration lock, so that it does not wait for a running
+// migration.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx, m.pool)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Version returns the highest applied migration version, 0 on a database
+// that was never migrated.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	exists, err := m.tableExists(ctx, m.pool)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int64
+	row := m.pool.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	err = row.Scan(&version)
+	return version, err
+}
+
+// CheckVersion fails with ErrSchemaVersion unless the database is exactly at
+// the version this binary was built for.
+func (m *Migrator) CheckVersion(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if version != m.LatestVersion() {
+		return fmt.Errorf("%w: database is at %d, expected %d", ErrSchemaVersion, version, m.LatestVersion())
+	}
+
+	return nil
+}
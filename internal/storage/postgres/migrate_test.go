@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDatabaseEnv names a PostgreSQL database to run the migrator against.
+// Tests that need it are skipped when it is not set.
+const testDatabaseEnv = "TEST_DATABASE_URI"
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, migration := range migrations {
+		if want := int64(i + 1); migration.Version != want {
+			t.Errorf("migration %d has version %d, want versions without gaps", i, migration.Version)
+		}
+		if migration.Name == "" || migration.Up == "" || migration.Down == "" {
+			t.Errorf("migration %d: name %q, up %d bytes, down %d bytes; want all set",
+				migration.Version, migration.Name, len(migration.Up), len(migration.Down))
+		}
+	}
+}
+
+// newTestPool connects to a new, empty schema of the test database, which is
+// dropped when the test ends, so that migrating up and down does not disturb
+// other packages using the database.
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func newTestMigrator(t *testing.T, pool *pgxpool.Pool, dryRun bool, out io.Writer) *Migrator {
+	t.Helper()
+	migrator, err := NewMigrator(pool, dryRun, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrator
+}
+
+func checkVersion(t *testing.T, migrator *Migrator, want int64) {
+	t.Helper()
+	if version, err := migrator.Version(context.Background()); err != nil || version != want {
+		t.Fatalf("Version = %d, %v; want %d", version, err, want)
+	}
+}
+
+func TestMigratorUpAndDown(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	migrator := newTestMigrator(t, pool, false, io.Discard)
+	latest := migrator.LatestVersion()
+
+	checkVersion(t, migrator, 0)
+	if err := migrator.CheckVersion(ctx); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("CheckVersion of an empty database: error = %v, want ErrSchemaVersion", err)
+	}
+
+	if err := migrator.Up(ctx, 3); err != nil {
+		t.Fatalf("Up(3): %v", err)
+	}
+	checkVersion(t, migrator, 3)
+	if err := migrator.CheckVersion(ctx); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("CheckVersion at version 3: error = %v, want ErrSchemaVersion", err)
+	}
+
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	checkVersion(t, migrator, latest)
+	if err := migrator.CheckVersion(ctx); err != nil {
+		t.Errorf("CheckVersion after Up: %v", err)
+	}
+	// Running again applies nothing.
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("migration %d is not applied after Up", status.Version)
+		}
+	}
+
+	if err := migrator.Down(ctx, 2); err != nil {
+		t.Fatalf("Down(2): %v", err)
+	}
+	checkVersion(t, migrator, latest-2)
+
+	// Every down script has to undo its up script for the schema to come
+	// back.
+	if err := migrator.Down(ctx, int(latest)); err != nil {
+		t.Fatalf("Down to nothing: %v", err)
+	}
+	checkVersion(t, migrator, 0)
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+	checkVersion(t, migrator, latest)
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	dryRun := newTestMigrator(t, pool, true, &out)
+	if err := dryRun.Up(ctx, 0); err != nil {
+		t.Fatalf("dry-run Up: %v", err)
+	}
+	if !strings.Contains(out.String(), "-- 0001_") || !strings.Contains(out.String(), "(up)") {
+		t.Errorf("dry-run Up printed %q, want the up scripts", out.String())
+	}
+	if exists, err := dryRun.tableExists(ctx, pool); err != nil || exists {
+		t.Errorf("schema_migrations exists = %v, %v after a dry run; want it not created", exists, err)
+	}
+
+	if err := newTestMigrator(t, pool, false, io.Discard).Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := dryRun.Down(ctx, 1); err != nil {
+		t.Fatalf("dry-run Down: %v", err)
+	}
+	if !strings.Contains(out.String(), "(down)") {
+		t.Errorf("dry-run Down printed %q, want the down script", out.String())
+	}
+	checkVersion(t, dryRun, dryRun.LatestVersion())
+}
+
+func TestMigratorWaitsForLock(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	migrator := newTestMigrator(t, pool, false, io.Discard)
+
+	holder, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Release()
+	if _, err := holder.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- migrator.Up(ctx, 0) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Up finished while another session held the lock: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Reading the status does not wait for a running migration.
+	statusCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if _, err := migrator.Status(statusCtx); err != nil {
+		t.Errorf("Status while the lock is held: %v", err)
+	}
+
+	if _, err := holder.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Up after the lock was released: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Up did not finish after the lock was released")
+	}
+	checkVersion(t, migrator, migrator.LatestVersion())
+}
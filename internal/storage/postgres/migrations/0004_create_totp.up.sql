@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id),
+    secret VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    code_hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS oidc_issuer VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_oidc_subject_idx ON users (oidc_issuer, oidc_subject);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS order_events (
+    id BIGSERIAL PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL REFERENCES orders(id),
+    status VARCHAR(10) NOT NULL,
+    accrual NUMERIC(10, 2) NOT NULL DEFAULT 0.0,
+    source VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS order_events_order_id_idx ON order_events (order_id, id);
+
+INSERT INTO order_events (order_id, status, accrual, source, created_at)
+SELECT id, COALESCE(status, 'NEW'), COALESCE(accrual, 0), 'user_upload', COALESCE(uploaded_at, CURRENT_TIMESTAMP)
+FROM orders
+WHERE NOT EXISTS (SELECT 1 FROM order_events WHERE order_events.order_id = orders.id);
+
+CREATE OR REPLACE FUNCTION order_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS order_events_append_only ON order_events;
+CREATE TRIGGER order_events_append_only BEFORE UPDATE OR DELETE ON order_events
+    FOR EACH ROW EXECUTE FUNCTION order_events_append_only();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_user_status_uploaded_idx;
+DROP INDEX IF EXISTS orders_user_uploaded_idx;
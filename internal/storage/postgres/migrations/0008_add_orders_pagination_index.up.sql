@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS orders_user_uploaded_idx ON orders (user_id, uploaded_at, id);
+CREATE INDEX IF NOT EXISTS orders_user_status_uploaded_idx ON orders (user_id, status, uploaded_at, id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS user_jobs (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    kind VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    result BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_jobs_status_idx ON user_jobs (status, created_at);
+CREATE INDEX IF NOT EXISTS user_jobs_user_id_idx ON user_jobs (user_id, kind, created_at);
@@ -0,0 +1 @@
+ALTER TABLE user_totp ALTER COLUMN secret TYPE TEXT;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_pending_poll_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS polled_at;
@@ -0,0 +1,4 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS polled_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS orders_pending_poll_idx ON orders (polled_at NULLS FIRST, uploaded_at)
+    WHERE status IN ('NEW', 'PROCESSING') AND withdrawn = 0;
@@ -2,63 +2,155 @@ package postgres
 
 import (
 	"context"
-	"os"
+	"fmt"
+	"io"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/metrics"
 )
 
-func CreateUsersTable(pool *pgxpool.Pool) error {
-	_, err := pool.Exec(context.Background(),
-		`CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		username VARCHAR(255) UNIQUE NOT NULL,
-		password VARCHAR(255) NOT NULL
-	)`)
+const (
+	connectRetryBase = 100 * time.Millisecond
+	connectRetryMax  = 5 * time.Second
+
+	// A replica that cannot be reached quickly is skipped in favour of the
+	// primary, so its connection attempts must not eat the request deadline.
+	replicaConnectTimeout = time.Second
+)
 
-	return err
+type PoolConfig struct {
+	DSN               string
+	MaxConns          int
+	MinConns          int
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	StartupTimeout    time.Duration
 }
 
-func CreateOrdersTable(pool *pgxpool.Pool) error {
-	_, err := pool.Exec(context.Background(),
-		`CREATE TABLE IF NOT EXISTS orders (
-		id VARCHAR(255) PRIMARY KEY,
-		status VARCHAR(10) DEFAULT 'NEW' CHECK (status IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED')),
-		accrual NUMERIC(10, 2) DEFAULT 0.0,
-		withdrawn NUMERIC(10, 2) DEFAULT 0.0,
-		uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		user_id INTEGER NOT NULL REFERENCES users(id)
-	)`)
-
-	return err
+func (c PoolConfig) parse() (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(c.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MaxConns > 0 {
+		config.MaxConns = int32(c.MaxConns)
+	}
+	if c.MinConns > 0 {
+		config.MinConns = int32(c.MinConns)
+	}
+	if c.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if c.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = c.HealthCheckPeriod
+	}
+	config.ConnConfig.Tracer = queryTracer{}
+
+	return config, nil
 }
 
-func SetupDB() (*pgxpool.Pool, error) {
-	dsn := os.Getenv("DATABASE_URI")
+// SetupDB connects to the database and makes sure its schema matches this
+// build, applying pending migrations first when autoMigrate is set. It keeps
+// retrying the connection until cfg.StartupTimeout has passed.
+func SetupDB(cfg PoolConfig, autoMigrate bool) (*pgxpool.Pool, error) {
+	config, err := cfg.parse()
+	if err != nil {
+		return nil, err
+	}
 
-	config, err := pgxpool.ParseConfig(dsn)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.StartupTimeout)
+	defer cancel()
+
+	pool, err := connect(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	migrator, err := NewMigrator(pool, false, io.Discard)
 	if err != nil {
+		pool.Close()
 		return nil, err
 	}
 
-	err = CreateUsersTable(pool)
+	if autoMigrate {
+		if err := migrator.Up(context.Background(), 0); err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+
+	if err := migrator.CheckVersion(context.Background()); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	logger.Log.Info("Database schema is up to date", "version", migrator.LatestVersion())
+
+	return pool, nil
+}
+
+// OpenReplica creates a pool for a read replica. It does not wait for the
+// replica to come up: reads fall back to the primary until it does.
+func OpenReplica(cfg PoolConfig) (*pgxpool.Pool, error) {
+	config, err := cfg.parse()
 	if err != nil {
 		return nil, err
 	}
+	config.ConnConfig.ConnectTimeout = replicaConnectTimeout
+	config.MinConns = 0
 
-	err = CreateOrdersTable(pool)
+	return pgxpool.NewWithConfig(context.Background(), config)
+}
+
+func connect(ctx context.Context, config *pgxpool.Config) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	return pool, nil
+	delay := connectRetryBase
+	for {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+
+		logger.Log.Warn("Database is not reachable, retrying", "error", err, "retry_in", delay.String())
+
+		select {
+		case <-ctx.Done():
+			pool.Close()
+			return nil, fmt.Errorf("database is not reachable: %w", err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, connectRetryMax)
+	}
 }
 
 // CloseDB closes the database connection
 func CloseDB(pool *pgxpool.Pool) {
 	pool.Close()
 }
+
+// PoolStats converts the statistics of pool for the metrics endpoint.
+func PoolStats(pool *pgxpool.Pool) metrics.PoolStats {
+	stat := pool.Stat()
+	return metrics.PoolStats{
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		TotalConns:           stat.TotalConns(),
+		MaxConns:             stat.MaxConns(),
+		AcquireCount:         stat.AcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/learies/gofermart/internal/config/logger"
+)
+
+// replicaBackoff is how long reads stay on the primary after the replica
+// failed to answer.
+const replicaBackoff = 10 * time.Second
+
+// readReplica routes read-only queries to a replica and falls back to the
+// primary while the replica is unavailable. A nil *readReplica always uses
+// the primary.
+type readReplica struct {
+	db        querier
+	downUntil atomic.Int64
+}
+
+func (r *readReplica) Query(ctx context.Context, primary querier, sql string, args ...any) (pgx.Rows, error) {
+	if r == nil || time.Now().UnixNano() < r.downUntil.Load() {
+		return primary.Query(ctx, sql, args...)
+	}
+
+	rows, err := r.db.Query(ctx, sql, args...)
+	if err == nil || !IsUnavailable(err) || ctx.Err() != nil {
+		return rows, err
+	}
+
+	logger.Log.WarnContext(ctx, "Read replica is unavailable, falling back to primary", "error", err)
+	r.downUntil.Store(time.Now().Add(replicaBackoff).UnixNano())
+
+	return primary.Query(ctx, sql, args...)
+}
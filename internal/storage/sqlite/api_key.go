@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type apiKeyStorage struct {
+	db querier
+}
+
+func NewAPIKeyStorage(db *sql.DB) storage.APIKeyStorage {
+	return &apiKeyStorage{
+		db: db,
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes,
+		&expiresAt, &key.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &key, nil
+}
+
+func (store *apiKeyStorage) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	var expiresAt interface{}
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC()
+	}
+
+	key.CreatedAt = time.Now().UTC()
+
+	row := store.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		key.UserID, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, ","), expiresAt, key.CreatedAt)
+
+	if err := row.Scan(&key.ID); err != nil {
+		if isUniqueViolation(err) {
+			return storage.ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (store *apiKeyStorage) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	rows, err := store.db.QueryContext(ctx,
+		`SELECT id, user_id, name, prefix, scopes, expires_at, created_at, last_used_at
+		FROM api_keys WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (store *apiKeyStorage) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	return expectRow(store.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), keyID, userID))
+}
+
+func (store *apiKeyStorage) RevokeAllAPIKeys(ctx context.Context, userID int64) error {
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID)
+	return err
+}
+
+func (store *apiKeyStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	row := store.db.QueryRowContext(ctx,
+		`SELECT id, user_id, name, prefix, scopes, expires_at, created_at, last_used_at
+		FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL`, keyHash)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (store *apiKeyStorage) TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error {
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC(), keyID)
+	return err
+}
@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+type auditStorage struct {
+	db querier
+}
+
+func (store *auditStorage) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	var details sql.NullString
+	if event.Details != nil {
+		data, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var userID sql.NullInt64
+	if event.UserID != 0 {
+		userID = sql.NullInt64{Int64: event.UserID, Valid: true}
+	}
+
+	event.CreatedAt = time.Now().UTC()
+	result, err := store.db.ExecContext(ctx,
+		`INSERT INTO audit_events (type, user_id, ip, user_agent, request_id, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		event.Type, userID, event.IP, event.UserAgent, event.RequestID, details, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+func (store *auditStorage) ListAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	var conditions []string
+	var args []any
+
+	if query.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, query.UserID)
+	}
+	if query.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, query.Type)
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, query.To.UTC())
+	}
+	if query.BeforeID != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, query.BeforeID)
+	}
+	args = append(args, query.Limit)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := store.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, type, user_id, ip, user_agent, request_id, details, created_at
+		FROM audit_events %s ORDER BY id DESC LIMIT ?`, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		var userID sql.NullInt64
+		var details sql.NullString
+		err := rows.Scan(&event.ID, &event.Type, &userID, &event.IP, &event.UserAgent,
+			&event.RequestID, &details, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.UserID = userID.Int64
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &event.Details); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (store *auditStorage) DeleteAuditEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := store.db.ExecContext(ctx, "DELETE FROM audit_events WHERE created_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (store *auditStorage) PseudonymizeAuditEvents(ctx context.Context, userID int64, login string) error {
+	_, err := store.db.ExecContext(ctx,
+		`UPDATE audit_events SET ip = '', user_agent = '', details = json_remove(details, '$.login')
+		WHERE user_id = ? OR json_extract(details, '$.login') = ?`,
+		userID, login)
+	return err
+}
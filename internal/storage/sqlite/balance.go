@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type balanceStorage struct {
+	db querier
+}
+
+func NewBalanceStorage(db *sql.DB) storage.BalanceStorage {
+	return &balanceStorage{
+		db: db,
+	}
+}
+
+func (store *balanceStorage) GetUserBalance(ctx context.Context, userID int64) (*models.UserBalance, error) {
+	var userBalance models.UserBalance
+
+	row := store.db.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(accrual) - SUM(withdrawn), 0), COALESCE(SUM(withdrawn), 0) FROM orders WHERE user_id = ?", userID)
+
+	if err := row.Scan(&userBalance.Current, &userBalance.Withdraw); err != nil {
+		return nil, err
+	}
+
+	return &userBalance, nil
+}
+
+func (store *balanceStorage) CheckBalanceWithdrawal(ctx context.Context, userID int64, amount float32) error {
+	userBalance, err := store.GetUserBalance(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if userBalance.Current < 0 {
+		return storage.ErrInsufficientFunds
+	}
+
+	return nil
+}
+
+func (store *balanceStorage) GetWithdrawalsByUserID(ctx context.Context, userID int64) (*[]models.UserWithdrawal, error) {
+	rows, err := store.db.QueryContext(ctx,
+		"SELECT id, withdrawn, uploaded_at FROM orders WHERE user_id = ? ORDER BY uploaded_at DESC, rowid DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userWithdrawals []models.UserWithdrawal
+	for rows.Next() {
+		var userWithdrawal models.UserWithdrawal
+		if err := rows.Scan(&userWithdrawal.OrderNumber, &userWithdrawal.Withdrawn, &userWithdrawal.UploadedAt); err != nil {
+			return nil, err
+		}
+		userWithdrawals = append(userWithdrawals, userWithdrawal)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &userWithdrawals, nil
+}
@@ -0,0 +1,20 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+)
+
+type health struct {
+	db *sql.DB
+}
+
+func (h *health) Ping(ctx context.Context) error {
+	return h.db.PingContext(ctx)
+}
+
+func (h *health) SchemaVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := h.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type jobStorage struct {
+	db querier
+}
+
+const jobColumns = "id, user_id, kind, status, error, created_at, started_at, finished_at"
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	var job models.Job
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.UserID, &job.Kind, &job.Status, &job.Error,
+		&job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
+
+func (store *jobStorage) CreateJob(ctx context.Context, job *models.Job) error {
+	job.CreatedAt = time.Now().UTC()
+	_, err := store.db.ExecContext(ctx,
+		"INSERT INTO user_jobs (id, user_id, kind, status, created_at) VALUES (?, ?, ?, ?, ?)",
+		job.ID, job.UserID, job.Kind, job.Status, job.CreatedAt)
+	return err
+}
+
+func (store *jobStorage) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
+	return scanJob(store.db.QueryRowContext(ctx,
+		"SELECT "+jobColumns+" FROM user_jobs WHERE id = ?", jobID))
+}
+
+func (store *jobStorage) GetLatestJob(ctx context.Context, userID int64, kind string) (*models.Job, error) {
+	return scanJob(store.db.QueryRowContext(ctx,
+		"SELECT "+jobColumns+" FROM user_jobs WHERE user_id = ? AND kind = ? ORDER BY created_at DESC LIMIT 1",
+		userID, kind))
+}
+
+func (store *jobStorage) GetJobResult(ctx context.Context, jobID string) ([]byte, error) {
+	var result []byte
+	err := store.db.QueryRowContext(ctx, "SELECT result FROM user_jobs WHERE id = ?", jobID).Scan(&result)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *jobStorage) ClaimJob(ctx context.Context, staleBefore time.Time) (*models.Job, error) {
+	var job *models.Job
+	err := inTx(ctx, store.db, func(tx querier) error {
+		var err error
+		job, err = scanJob(tx.QueryRowContext(ctx,
+			"SELECT "+jobColumns+` FROM user_jobs
+			WHERE status = ? OR (status = ? AND started_at < ?)
+			ORDER BY created_at LIMIT 1`,
+			models.JobStatusPending, models.JobStatusRunning, staleBefore.UTC()))
+		if err != nil {
+			return err
+		}
+
+		startedAt := time.Now().UTC()
+		job.Status = models.JobStatusRunning
+		job.StartedAt = &startedAt
+		_, err = tx.ExecContext(ctx,
+			"UPDATE user_jobs SET status = ?, started_at = ? WHERE id = ?",
+			job.Status, startedAt, job.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (store *jobStorage) FinishJob(ctx context.Context, jobID, status, errorMessage string, result []byte) error {
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE user_jobs SET status = ?, error = ?, result = ?, finished_at = ? WHERE id = ?",
+		status, errorMessage, result, time.Now().UTC(), jobID)
+	return err
+}
+
+func (store *jobStorage) ClearJobResults(ctx context.Context, userID int64) error {
+	_, err := store.db.ExecContext(ctx, "UPDATE user_jobs SET result = NULL WHERE user_id = ?", userID)
+	return err
+}
+
+func (store *jobStorage) DeleteJobsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := store.db.ExecContext(ctx, "DELETE FROM user_jobs WHERE finished_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type loginAttemptStorage struct {
+	db querier
+}
+
+func NewLoginAttemptStorage(db *sql.DB) storage.LoginAttemptStorage {
+	return &loginAttemptStorage{
+		db: db,
+	}
+}
+
+func (store *loginAttemptStorage) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	attempt := models.LoginAttempt{Key: key}
+
+	row := store.db.QueryRowContext(ctx,
+		"SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = ?", key)
+
+	err := row.Scan(&attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &attempt, nil
+		}
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+func (store *loginAttemptStorage) RegisterLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	row := store.db.QueryRowContext(ctx,
+		`INSERT INTO login_attempts (key, failures, last_failure_at) VALUES (?1, 1, ?2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ?3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures`,
+		key, now.UTC(), now.Add(-window).UTC())
+
+	var failures int
+	if err := row.Scan(&failures); err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (store *loginAttemptStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE login_attempts SET locked_until = ? WHERE key = ?", until.UTC(), key)
+	return err
+}
+
+func (store *loginAttemptStorage) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := store.db.ExecContext(ctx,
+		"DELETE FROM login_attempts WHERE key = ?", key)
+	return err
+}
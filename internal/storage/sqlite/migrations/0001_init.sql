@@ -0,0 +1,52 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    token_version INTEGER NOT NULL DEFAULT 0,
+    oidc_issuer TEXT,
+    oidc_subject TEXT
+);
+
+CREATE UNIQUE INDEX users_oidc_subject_idx ON users (oidc_issuer, oidc_subject);
+
+CREATE TABLE orders (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL DEFAULT 'NEW' CHECK (status IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED')),
+    accrual REAL NOT NULL DEFAULT 0,
+    withdrawn REAL NOT NULL DEFAULT 0,
+    uploaded_at TIMESTAMP NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id)
+);
+
+CREATE TABLE login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00'
+);
+
+CREATE TABLE user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id),
+    secret TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 0,
+    last_step INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE user_recovery_codes (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    code_hash TEXT NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
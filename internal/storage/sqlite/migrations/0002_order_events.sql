@@ -0,0 +1,23 @@
+CREATE TABLE order_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id TEXT NOT NULL REFERENCES orders(id),
+    status TEXT NOT NULL,
+    accrual REAL NOT NULL DEFAULT 0,
+    source TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX order_events_order_id_idx ON order_events (order_id, id);
+
+INSERT INTO order_events (order_id, status, accrual, source, created_at)
+SELECT id, status, accrual, 'user_upload', uploaded_at FROM orders;
+
+CREATE TRIGGER order_events_no_update BEFORE UPDATE ON order_events
+BEGIN
+    SELECT RAISE(ABORT, 'order_events is append-only');
+END;
+
+CREATE TRIGGER order_events_no_delete BEFORE DELETE ON order_events
+BEGIN
+    SELECT RAISE(ABORT, 'order_events is append-only');
+END;
@@ -0,0 +1,15 @@
+CREATE TABLE audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    user_id INTEGER,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    details TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, id);
+
+ALTER TABLE users ADD COLUMN is_admin INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+CREATE TABLE user_jobs (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    kind TEXT NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    result BLOB,
+    created_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX user_jobs_status_idx ON user_jobs (status, created_at);
+CREATE INDEX user_jobs_user_id_idx ON user_jobs (user_id, kind, created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE orders ADD COLUMN polled_at TIMESTAMP;
+
+CREATE INDEX orders_pending_poll_idx ON orders (polled_at, uploaded_at)
+    WHERE status IN ('NEW', 'PROCESSING') AND withdrawn = 0;
@@ -0,0 +1,233 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type orderStorage struct {
+	db querier
+}
+
+func NewOrderStorage(db *sql.DB) storage.OrderStorage {
+	return &orderStorage{
+		db: db,
+	}
+}
+
+func (store *orderStorage) CreateOrder(ctx context.Context, order models.Order) error {
+	err := inTx(ctx, store.db, func(tx querier) error {
+		now := time.Now().UTC()
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO orders (id, status, accrual, withdrawn, user_id, uploaded_at) VALUES (?, ?, ?, ?, ?, ?)",
+			order.OrderID, order.Status, order.Accrual, order.Withdrawn, order.UserID, now)
+		if err != nil {
+			return err
+		}
+		return insertOrderEvent(ctx, tx, order.OrderID, order.Status, order.Accrual, models.OrderEventSourceUpload, now)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return storage.ErrConflict
+		}
+		return err
+	}
+
+	logger.Log.InfoContext(ctx, "Order created successfully", "order", order)
+	return nil
+}
+
+func (store *orderStorage) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	var order models.Order
+
+	row := store.db.QueryRowContext(ctx,
+		"SELECT id, user_id FROM orders WHERE id = ?", orderID)
+
+	if err := row.Scan(&order.OrderID, &order.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &order, nil
+		}
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (store *orderStorage) GetUserOrders(ctx context.Context, userID int64) (*[]models.OrderResponse, error) {
+	rows, err := store.db.QueryContext(ctx,
+		"SELECT id, status, accrual, uploaded_at FROM orders WHERE user_id = ? ORDER BY uploaded_at DESC, rowid DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.OrderResponse
+	for rows.Next() {
+		var order models.OrderResponse
+		if err := rows.Scan(&order.OrderID, &order.Status, &order.Accrual, &order.UploadedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &orders, nil
+}
+
+func insertOrderEvent(ctx context.Context, db querier, orderID, status string, accrual float32, source string, at time.Time) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO order_events (order_id, status, accrual, source, created_at) VALUES (?, ?, ?, ?, ?)",
+		orderID, status, accrual, source, at)
+	return err
+}
+
+func (store *orderStorage) ListUserOrders(ctx context.Context, userID int64, query models.OrderQuery) ([]models.OrderResponse, error) {
+	conditions := []string{"user_id = ?"}
+	args := []any{userID}
+
+	if len(query.Statuses) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(query.Statuses)), ", ")
+		conditions = append(conditions, "status IN ("+placeholders+")")
+		for _, status := range query.Statuses {
+			args = append(args, status)
+		}
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "uploaded_at >= ?")
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "uploaded_at < ?")
+		args = append(args, query.To.UTC())
+	}
+
+	direction, compare := "DESC", "<"
+	if query.Ascending {
+		direction, compare = "ASC", ">"
+	}
+	if query.After != nil {
+		conditions = append(conditions, "(uploaded_at, id) "+compare+" (?, ?)")
+		args = append(args, query.After.UploadedAt.UTC(), query.After.OrderID)
+	}
+	args = append(args, query.Limit)
+
+	rows, err := store.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT id, status, accrual, uploaded_at FROM orders WHERE %s ORDER BY uploaded_at %s, id %s LIMIT ?",
+		strings.Join(conditions, " AND "), direction, direction), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.OrderResponse
+	for rows.Next() {
+		var order models.OrderResponse
+		if err := rows.Scan(&order.OrderID, &order.Status, &order.Accrual, &order.UploadedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+func (store *orderStorage) GetUserOrder(ctx context.Context, userID int64, orderID string) (*models.OrderTimeline, error) {
+	var timeline models.OrderTimeline
+
+	row := store.db.QueryRowContext(ctx,
+		"SELECT id, status, accrual, withdrawn, uploaded_at FROM orders WHERE id = ? AND user_id = ?", orderID, userID)
+
+	err := row.Scan(&timeline.OrderID, &timeline.Status, &timeline.Accrual, &timeline.Withdrawn, &timeline.UploadedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := store.db.QueryContext(ctx,
+		"SELECT status, accrual, source, created_at FROM order_events WHERE order_id = ? ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timeline.Events = []models.OrderEvent{}
+	for rows.Next() {
+		var event models.OrderEvent
+		if err := rows.Scan(&event.Status, &event.Accrual, &event.Source, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		timeline.Events = append(timeline.Events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &timeline, nil
+}
+
+// pendingOrder selects uploaded orders whose accrual is not final yet.
+// Withdrawals are orders too, but are never accrued.
+const pendingOrder = "status IN ('NEW', 'PROCESSING') AND withdrawn = 0"
+
+func (store *orderStorage) ClaimPendingOrders(ctx context.Context, limit int, polledBefore time.Time) ([]models.Order, error) {
+	rows, err := store.db.QueryContext(ctx,
+		`UPDATE orders SET polled_at = ? WHERE id IN (
+			SELECT id FROM orders WHERE `+pendingOrder+` AND (polled_at IS NULL OR polled_at < ?)
+			ORDER BY polled_at IS NOT NULL, polled_at, uploaded_at, rowid LIMIT ?)
+		RETURNING id, status, user_id`,
+		time.Now().UTC(), polledBefore.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(&order.OrderID, &order.Status, &order.UserID); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+func (store *orderStorage) CountPendingOrders(ctx context.Context) (int64, error) {
+	var count int64
+	err := store.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM orders WHERE "+pendingOrder).Scan(&count)
+	return count, err
+}
+
+func (store *orderStorage) UpdateOrderStatus(ctx context.Context, orderID, status string, accrual float32, source string) error {
+	return inTx(ctx, store.db, func(tx querier) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE orders SET status = ?, accrual = ? WHERE id = ? AND (status <> ? OR accrual <> ?)",
+			status, accrual, orderID, status, accrual)
+		if err != nil {
+			return err
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil || updated == 0 {
+			return err
+		}
+
+		return insertOrderEvent(ctx, tx, orderID, status, accrual, source, time.Now().UTC())
+	})
+}
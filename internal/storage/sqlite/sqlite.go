@@ -0,0 +1,298 @@
+// Package sqlite stores data in an embedded SQLite database, for single-node
+// deployments that do not want to operate PostgreSQL.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const scheme = "sqlite:"
+
+// IsDSN reports whether dsn selects the SQLite backend, e.g.
+// sqlite:///var/lib/gophermart.db or sqlite://gophermart.db.
+func IsDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, scheme)
+}
+
+var ErrSchemaVersion = errors.New("unexpected schema version")
+
+// Open opens the database file named by dsn, applies pending migrations if
+// autoMigrate is set, and fails with ErrSchemaVersion unless the schema is
+// then at the version this binary was built for.
+func Open(ctx context.Context, dsn string, autoMigrate bool) (*sql.DB, error) {
+	db, err := Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if autoMigrate {
+		if err := Migrate(ctx, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if err := checkVersion(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Connect opens the database file named by dsn in WAL mode, without touching
+// the schema. Transactions take the write lock up front so that concurrent
+// read-modify-write sequences are serialized instead of failing with SQLITE_BUSY.
+func Connect(ctx context.Context, dsn string) (*sql.DB, error) {
+	file := strings.TrimPrefix(strings.TrimPrefix(dsn, scheme), "//")
+
+	separator := "?"
+	if strings.Contains(file, "?") {
+		separator = "&"
+	}
+	file += separator + "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)" +
+		"&_txlock=immediate&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", "file:"+file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func New(db *sql.DB, auth services.AuthService) *storage.Storage {
+	store := newStorage(traced{db}, auth)
+	store.Tx = &txManager{db: traced{db}, auth: auth}
+	store.Health = &health{db: db}
+	return store
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func newStorage(db querier, auth services.AuthService) *storage.Storage {
+	return &storage.Storage{
+		Users:         &userStorage{db: db, auth: auth},
+		Orders:        &orderStorage{db: db},
+		Balance:       &balanceStorage{db: db},
+		LoginAttempts: &loginAttemptStorage{db: db},
+		TOTP:          &totpStorage{db: db},
+		APIKeys:       &apiKeyStorage{db: db},
+		Audit:         &auditStorage{db: db},
+		Jobs:          &jobStorage{db: db},
+	}
+}
+
+// txManager runs units of work in immediate transactions. SQLite serializes
+// writers, so every isolation level behaves as serializable; retries only
+// cover a lock that could not be taken within the busy timeout.
+type txManager struct {
+	db   querier
+	auth services.AuthService
+}
+
+func (m *txManager) WithinTx(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context, tx *storage.Storage) error) error {
+	return storage.RetryTx(ctx, opts.MaxRetries, isBusy, func() error {
+		return inTx(ctx, m.db, func(tx querier) error {
+			return fn(ctx, storage.JoinTx(newStorage(tx, m.auth)))
+		})
+	})
+}
+
+type migration struct {
+	version int64
+	name    string
+	file    string
+}
+
+// loadMigrations lists the embedded NNNN_name.sql files, ordered by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		versionPart, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("malformed migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed migration version in %q: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, migration{version: version, name: name, file: entry.Name()})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// schemaVersion returns the highest applied migration version, 0 on a
+// database that was never migrated.
+func schemaVersion(ctx context.Context, db querier) (int64, error) {
+	var exists bool
+	row := db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')")
+	if err := row.Scan(&exists); err != nil || !exists {
+		return 0, err
+	}
+
+	var version int64
+	row = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	err := row.Scan(&version)
+	return version, err
+}
+
+func checkVersion(ctx context.Context, db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	var latest int64
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version != latest {
+		return fmt.Errorf("%w: database is at %d, expected %d", ErrSchemaVersion, version, latest)
+	}
+
+	logger.Log.InfoContext(ctx, "Database schema is up to date", "version", version)
+	return nil
+}
+
+// Migrate applies the pending migrations.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		script, err := migrationFiles.ReadFile(path.Join("migrations", m.file))
+		if err != nil {
+			return err
+		}
+
+		err = inTx(ctx, db, func(tx querier) error {
+			if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+				return fmt.Errorf("migration %d failed: %w", m.version, err)
+			}
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.version, m.name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		logger.Log.InfoContext(ctx, "Applied SQLite migration", "version", m.version, "name", m.name)
+	}
+
+	return nil
+}
+
+// inTx runs fn in a new transaction, or directly when db already is one. A
+// traced database yields a traced transaction.
+func inTx(ctx context.Context, db querier, fn func(tx querier) error) error {
+	inner := db
+	wrapped, isTraced := db.(traced)
+	if isTraced {
+		inner = wrapped.q
+	}
+	conn, ok := inner.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var q querier = tx
+	if isTraced {
+		q = traced{tx}
+	}
+	if err := fn(q); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+		sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY ||
+		sqliteErr.Code()&0xff == sqlite3.SQLITE_LOCKED
+}
@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type totpStorage struct {
+	db querier
+}
+
+func NewTOTPStorage(db *sql.DB) storage.TOTPStorage {
+	return &totpStorage{
+		db: db,
+	}
+}
+
+func (store *totpStorage) SaveTOTPSecret(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error {
+
+	return inTx(ctx, store.db, func(tx querier) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO user_totp (user_id, secret, enabled, last_step) VALUES (?1, ?2, 0, 0)
+			ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, enabled = 0, last_step = 0`,
+			userID, secret)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+
+		for _, codeHash := range recoveryCodeHashes {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, codeHash)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *totpStorage) GetTOTP(ctx context.Context, userID int64) (*models.TOTP, error) {
+	totp := models.TOTP{UserID: userID}
+
+	row := store.db.QueryRowContext(ctx,
+		"SELECT secret, enabled, last_step FROM user_totp WHERE user_id = ?", userID)
+
+	err := row.Scan(&totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &totp, nil
+		}
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+func (store *totpStorage) EnableTOTP(ctx context.Context, userID int64) error {
+	return expectRow(store.db.ExecContext(ctx,
+		"UPDATE user_totp SET enabled = 1 WHERE user_id = ?", userID))
+}
+
+func (store *totpStorage) DisableTOTP(ctx context.Context, userID int64) error {
+
+	return inTx(ctx, store.db, func(tx querier) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = ?", userID)
+		return err
+	})
+}
+
+func (store *totpStorage) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	err := expectRow(store.db.ExecContext(ctx,
+		"UPDATE user_totp SET last_step = ?2 WHERE user_id = ?1 AND last_step < ?2", userID, step))
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.ErrConflict
+	}
+	return err
+}
+
+func (store *totpStorage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	return expectRow(store.db.ExecContext(ctx,
+		"DELETE FROM user_recovery_codes WHERE user_id = ? AND code_hash = ?", userID, codeHash))
+}
+
+// expectRow turns an Exec result that touched no rows into ErrNotFound.
+func expectRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
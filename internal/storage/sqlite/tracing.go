@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/learies/gofermart/internal/tracing"
+)
+
+// traced records a client span for every query run through q.
+type traced struct {
+	q querier
+}
+
+func startSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "sqlite query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t traced) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startSpan(ctx, query)
+	result, err := t.q.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t traced) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startSpan(ctx, query)
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+// QueryRowContext ends the span once the query has run; scan errors such as
+// sql.ErrNoRows are left to the caller.
+func (t traced) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := startSpan(ctx, query)
+	row := t.q.QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
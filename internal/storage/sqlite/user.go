@@ -0,0 +1,162 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+type userStorage struct {
+	db   querier
+	auth services.AuthService
+}
+
+func NewUserStorage(db *sql.DB, auth services.AuthService) storage.UserStorage {
+	return &userStorage{
+		db:   db,
+		auth: auth,
+	}
+}
+
+func (store *userStorage) CreateUser(ctx context.Context, username, password string) (int64, error) {
+	hashedPassword, err := store.auth.HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	row := store.db.QueryRowContext(ctx,
+		"INSERT INTO users (username, password) VALUES (?, ?) RETURNING id",
+		username, hashedPassword)
+
+	var userID int64
+	if err := row.Scan(&userID); err != nil {
+		if isUniqueViolation(err) {
+			return 0, storage.ErrConflict
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (store *userStorage) getUser(ctx context.Context, query string, args ...interface{}) (*models.User, error) {
+	row := store.db.QueryRowContext(ctx, query, args...)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.TokenVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (store *userStorage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return store.getUser(ctx,
+		"SELECT id, username, password, token_version FROM users WHERE username = ?", username)
+}
+
+func (store *userStorage) GetUserByID(ctx context.Context, userID int64) (*models.User, error) {
+	return store.getUser(ctx,
+		"SELECT id, username, password, token_version FROM users WHERE id = ?", userID)
+}
+
+func (store *userStorage) GetTokenVersion(ctx context.Context, userID int64) (int, error) {
+	row := store.db.QueryRowContext(ctx,
+		"SELECT token_version FROM users WHERE id = ?", userID)
+
+	var version int
+	if err := row.Scan(&version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storage.ErrNotFound
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (store *userStorage) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) (int, error) {
+	row := store.db.QueryRowContext(ctx,
+		"UPDATE users SET password = ?, token_version = token_version + 1 WHERE id = ? RETURNING token_version",
+		hashedPassword, userID)
+
+	var version int
+	if err := row.Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (store *userStorage) UpdatePasswordHash(ctx context.Context, userID int64, hashedPassword string) error {
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE users SET password = ? WHERE id = ?", hashedPassword, userID)
+	return err
+}
+
+func (store *userStorage) GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return store.getUser(ctx,
+		"SELECT id, username, password, token_version FROM users WHERE oidc_issuer = ? AND oidc_subject = ?",
+		issuer, subject)
+}
+
+func (store *userStorage) CreateOIDCUser(ctx context.Context, username, issuer, subject string) (int64, error) {
+	row := store.db.QueryRowContext(ctx,
+		"INSERT INTO users (username, password, oidc_issuer, oidc_subject) VALUES (?, ?, ?, ?) RETURNING id",
+		username, storage.UnusablePassword, issuer, subject)
+
+	var userID int64
+	if err := row.Scan(&userID); err != nil {
+		if isUniqueViolation(err) {
+			return 0, storage.ErrConflict
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (store *userStorage) LinkOIDCSubject(ctx context.Context, userID int64, issuer, subject string) error {
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE users SET oidc_issuer = ?, oidc_subject = ? WHERE id = ?", issuer, subject, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return storage.ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (store *userStorage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	var isAdmin bool
+	err := store.db.QueryRowContext(ctx, "SELECT is_admin FROM users WHERE id = ?", userID).Scan(&isAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, storage.ErrNotFound
+		}
+		return false, err
+	}
+
+	return isAdmin, nil
+}
+
+func (store *userStorage) SetAdmin(ctx context.Context, userID int64, admin bool) error {
+	return expectRow(store.db.ExecContext(ctx, "UPDATE users SET is_admin = ? WHERE id = ?", admin, userID))
+}
+
+func (store *userStorage) AnonymizeUser(ctx context.Context, userID int64, username string) error {
+	return expectRow(store.db.ExecContext(ctx,
+		`UPDATE users SET username = ?, password = ?, oidc_issuer = NULL, oidc_subject = NULL,
+		is_admin = 0, token_version = token_version + 1 WHERE id = ?`,
+		username, storage.UnusablePassword, userID))
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/learies/gofermart/internal/services"
+)
+
+// Storage bundles the storages of one backend.
+type Storage struct {
+	Users         UserStorage
+	Orders        OrderStorage
+	Balance       BalanceStorage
+	LoginAttempts LoginAttemptStorage
+	TOTP          TOTPStorage
+	APIKeys       APIKeyStorage
+	Audit         AuditStorage
+	Jobs          JobStorage
+
+	Tx     TxManager
+	Health HealthChecker
+}
+
+// querier is implemented by both *pgxpool.Pool and pgx.Tx, so that every
+// PostgreSQL storage can run inside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// NewPostgres returns the PostgreSQL storages. replica may be nil; when set,
+// listings that tolerate replication lag are read from it.
+func NewPostgres(dbPool, replica *pgxpool.Pool, auth services.AuthService) *Storage {
+	store := newPostgres(dbPool, auth)
+	store.Tx = &pgTxManager{pool: dbPool, auth: auth}
+	store.Health = &pgHealth{pool: dbPool}
+
+	if replica != nil {
+		reads := &readReplica{db: replica}
+		store.Orders.(*orderStorage).replica = reads
+		store.Balance.(*balanceStorage).replica = reads
+	}
+
+	return store
+}
+
+func newPostgres(db querier, auth services.AuthService) *Storage {
+	return &Storage{
+		Users:         &userStorage{db: db, auth: auth},
+		Orders:        &orderStorage{db: db},
+		Balance:       &balanceStorage{db: db},
+		LoginAttempts: &loginAttemptStorage{db: db},
+		TOTP:          &totpStorage{db: db},
+		APIKeys:       &apiKeyStorage{db: db},
+		Audit:         &auditStorage{db: db},
+		Jobs:          &jobStorage{db: db},
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/learies/gofermart/internal/models"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type TOTPStorage interface {
+	SaveTOTPSecret(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error
+	GetTOTP(ctx context.Context, userID int64) (*models.TOTP, error)
+	EnableTOTP(ctx context.Context, userID int64) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	UseTOTPStep(ctx context.Context, userID int64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+}
+
+type totpStorage struct {
+	db querier
+}
+
+func NewTOTPStorage(dbPool *pgxpool.Pool) TOTPStorage {
+	return &totpStorage{
+		db: dbPool,
+	}
+}
+
+// SaveTOTPSecret starts a new, not yet enabled enrolment and replaces any
+// previous secret and recovery codes of the user.
+func (store *totpStorage) SaveTOTPSecret(ctx context.Context, userID int64, secret string, recoveryCodeHashes []string) error {
+
+	tx, err := store.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO user_totp (user_id, secret, enabled, last_step) VALUES ($1, $2, FALSE, 0)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled = FALSE, last_step = 0`,
+		userID, secret)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (store *totpStorage) GetTOTP(ctx context.Context, userID int64) (*models.TOTP, error) {
+	totp := models.TOTP{UserID: userID}
+
+	row := store.db.QueryRow(ctx,
+		"SELECT secret, enabled, last_step FROM user_totp WHERE user_id = $1", userID)
+
+	err := row.Scan(&totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &totp, nil
+		}
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+func (store *totpStorage) EnableTOTP(ctx context.Context, userID int64) error {
+	tag, err := store.db.Exec(ctx,
+		"UPDATE user_totp SET enabled = TRUE WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *totpStorage) DisableTOTP(ctx context.Context, userID int64) error {
+
+	if _, err := store.db.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err := store.db.Exec(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID)
+	return err
+}
+
+// UseTOTPStep records step as consumed. It returns ErrConflict if the same or
+// a later step has already been used.
+func (store *totpStorage) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	tag, err := store.db.Exec(ctx,
+		"UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2", userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (store *totpStorage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	tag, err := store.db.Exec(ctx,
+		"DELETE FROM user_recovery_codes WHERE user_id = $1 AND code_hash = $2", userID, codeHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/services"
+)
+
+type IsolationLevel int
+
+const (
+	ReadCommitted IsolationLevel = iota
+	RepeatableRead
+	Serializable
+)
+
+type TxOptions struct {
+	Isolation IsolationLevel
+	// MaxRetries is how many times a unit of work is re-run after a
+	// serialization failure or deadlock. Zero disables retries.
+	MaxRetries int
+}
+
+// TxManager runs units of work atomically. fn receives storages bound to the
+// transaction: it is committed when fn returns nil and rolled back otherwise.
+// Since fn may run more than once, it must not have side effects outside
+// the storages it is given.
+type TxManager interface {
+	WithinTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context, tx *Storage) error) error
+}
+
+type joinedTx struct {
+	store *Storage
+}
+
+func (j joinedTx) WithinTx(ctx context.Context, _ TxOptions, fn func(ctx context.Context, tx *Storage) error) error {
+	return fn(ctx, j.store)
+}
+
+// JoinTx makes units of work started from a transaction-scoped store run in
+// that same transaction instead of opening a nested one.
+func JoinTx(store *Storage) *Storage {
+	store.Tx = joinedTx{store: store}
+	return store
+}
+
+const retryBaseDelay = 10 * time.Millisecond
+
+// RetryTx calls run until it succeeds, fails with an error that retryable
+// rejects, or maxRetries re-runs have been spent.
+func RetryTx(ctx context.Context, maxRetries int, retryable func(error) bool, run func() error) error {
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= maxRetries || !retryable(err) {
+			return err
+		}
+
+		logger.Log.WarnContext(ctx, "Retrying transaction", "attempt", attempt+1, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+type pgTxManager struct {
+	pool *pgxpool.Pool
+	auth services.AuthService
+}
+
+func (m *pgTxManager) WithinTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context, tx *Storage) error) error {
+	txOptions := pgx.TxOptions{IsoLevel: pgx.ReadCommitted}
+	switch opts.Isolation {
+	case RepeatableRead:
+		txOptions.IsoLevel = pgx.RepeatableRead
+	case Serializable:
+		txOptions.IsoLevel = pgx.Serializable
+	}
+
+	return RetryTx(ctx, opts.MaxRetries, isSerializationFailure, func() error {
+		return pgx.BeginTxFunc(ctx, m.pool, txOptions, func(tx pgx.Tx) error {
+			return fn(ctx, JoinTx(newPostgres(tx, m.auth)))
+		})
+	})
+}
+
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		(pgErr.Code == pgerrcode.SerializationFailure || pgErr.Code == pgerrcode.DeadlockDetected)
+}
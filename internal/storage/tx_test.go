@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRetryTx(t *testing.T) {
+	serialization := &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	deadlock := &pgconn.PgError{Code: pgerrcode.DeadlockDetected}
+	unique := &pgconn.PgError{Code: pgerrcode.UniqueViolation}
+
+	tests := []struct {
+		name       string
+		maxRetries int
+		// errs are returned by successive runs; runs past the end succeed.
+		errs     []error
+		wantRuns int
+		wantErr  error
+	}{
+		{name: "success", maxRetries: 3, wantRuns: 1},
+		{name: "serialization failure retried", maxRetries: 3, errs: []error{serialization}, wantRuns: 2},
+		{name: "deadlock retried", maxRetries: 3, errs: []error{deadlock, deadlock}, wantRuns: 3},
+		{name: "wrapped failure retried", maxRetries: 3, errs: []error{fmt.Errorf("withdraw: %w", serialization)}, wantRuns: 2},
+		{
+			name:       "retries exhausted",
+			maxRetries: 2,
+			errs:       []error{serialization, deadlock, serialization, nil},
+			wantRuns:   3,
+			wantErr:    serialization,
+		},
+		{name: "retries disabled", errs: []error{serialization}, wantRuns: 1, wantErr: serialization},
+		{name: "other error not retried", maxRetries: 3, errs: []error{unique}, wantRuns: 1, wantErr: unique},
+		{name: "plain error not retried", maxRetries: 3, errs: []error{ErrConflict}, wantRuns: 1, wantErr: ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs int
+			err := RetryTx(context.Background(), tt.maxRetries, isSerializationFailure, func() error {
+				runs++
+				if runs <= len(tt.errs) {
+					return tt.errs[runs-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RetryTx error = %v, want %v", err, tt.wantErr)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("run %d times, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestRetryTxStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs int
+	err := RetryTx(ctx, 10, isSerializationFailure, func() error {
+		runs++
+		cancel()
+		return &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	})
+	if !errors.Is(err, context.Canceled) || runs != 1 {
+		t.Errorf("RetryTx = %v after %d runs, want context.Canceled after 1", err, runs)
+	}
+}
+
+func TestJoinTx(t *testing.T) {
+	store := JoinTx(&Storage{})
+
+	var runs int
+	err := store.Tx.WithinTx(context.Background(), TxOptions{MaxRetries: 5}, func(ctx context.Context, tx *Storage) error {
+		runs++
+		if tx != store {
+			t.Error("joined unit of work got another store")
+		}
+		return &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+	})
+	if !isSerializationFailure(err) || runs != 1 {
+		t.Errorf("WithinTx = %v after %d runs; want the error of the single run, left for the outer transaction to retry", err, runs)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
@@ -15,30 +16,45 @@ import (
 var ErrConflict = errors.New("data conflict")
 
 type UserStorage interface {
-	CreateUser(username, password string) (int64, error)
-	GetUserByUsername(username string) (*models.User, error)
+	CreateUser(ctx context.Context, username, password string) (int64, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	GetUserByID(ctx context.Context, userID int64) (*models.User, error)
+	GetTokenVersion(ctx context.Context, userID int64) (int, error)
+	UpdatePassword(ctx context.Context, userID int64, hashedPassword string) (int, error)
+	UpdatePasswordHash(ctx context.Context, userID int64, hashedPassword string) error
+	GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error)
+	CreateOIDCUser(ctx context.Context, username, issuer, subject string) (int64, error)
+	LinkOIDCSubject(ctx context.Context, userID int64, issuer, subject string) error
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	SetAdmin(ctx context.Context, userID int64, admin bool) error
+	AnonymizeUser(ctx context.Context, userID int64, username string) error
 }
 
+// UnusablePassword is stored for accounts created through OpenID Connect and
+// for anonymised accounts. It is not a valid hash, so password login always
+// fails for them.
+const UnusablePassword = "!"
+
 type userStorage struct {
-	db   *pgxpool.Pool
+	db   querier
 	auth services.AuthService
 }
 
-func NewPostgresStorage(dbPool *pgxpool.Pool) UserStorage {
+func NewPostgresStorage(dbPool *pgxpool.Pool, auth services.AuthService) UserStorage {
 	return &userStorage{
 		db:   dbPool,
-		auth: services.NewAuthService(),
+		auth: auth,
 	}
 }
 
-func (store *userStorage) CreateUser(username, password string) (int64, error) {
+func (store *userStorage) CreateUser(ctx context.Context, username, password string) (int64, error) {
 
 	hashedPassword, err := store.auth.HashPassword(password)
 	if err != nil {
 		return 0, err
 	}
 
-	row := store.db.QueryRow(context.Background(),
+	row := store.db.QueryRow(ctx,
 		"INSERT INTO users (username, password) VALUES($1, $2) RETURNING id",
 		username, hashedPassword)
 
@@ -55,15 +71,167 @@ func (store *userStorage) CreateUser(username, password string) (int64, error) {
 	return userID, nil
 }
 
-func (store *userStorage) GetUserByUsername(username string) (*models.User, error) {
-	row := store.db.QueryRow(context.Background(),
-		"SELECT id, username, password FROM users WHERE username=$1", username)
+func (store *userStorage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	row := store.db.QueryRow(ctx,
+		"SELECT id, username, password, token_version FROM users WHERE username=$1", username)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.TokenVersion)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (store *userStorage) GetUserByID(ctx context.Context, userID int64) (*models.User, error) {
+	row := store.db.QueryRow(ctx,
+		"SELECT id, username, password, token_version FROM users WHERE id=$1", userID)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.TokenVersion)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (store *userStorage) GetTokenVersion(ctx context.Context, userID int64) (int, error) {
+	row := store.db.QueryRow(ctx,
+		"SELECT token_version FROM users WHERE id=$1", userID)
+
+	var version int
+	if err := row.Scan(&version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// UpdatePassword stores a new password hash and bumps the token version, which
+// invalidates every session issued before the change. It returns the new version.
+func (store *userStorage) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) (int, error) {
+	row := store.db.QueryRow(ctx,
+		"UPDATE users SET password = $2, token_version = token_version + 1 WHERE id = $1 RETURNING token_version",
+		userID, hashedPassword)
+
+	var version int
+	if err := row.Scan(&version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// UpdatePasswordHash replaces the stored hash of an unchanged password, e.g.
+// after the hashing parameters were changed. Sessions stay valid.
+func (store *userStorage) UpdatePasswordHash(ctx context.Context, userID int64, hashedPassword string) error {
+	_, err := store.db.Exec(ctx,
+		"UPDATE users SET password = $2 WHERE id = $1", userID, hashedPassword)
+	return err
+}
+
+func (store *userStorage) GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	row := store.db.QueryRow(ctx,
+		"SELECT id, username, password, token_version FROM users WHERE oidc_issuer = $1 AND oidc_subject = $2",
+		issuer, subject)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Password)
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.TokenVersion)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 
 	return &user, nil
 }
+
+func (store *userStorage) CreateOIDCUser(ctx context.Context, username, issuer, subject string) (int64, error) {
+	row := store.db.QueryRow(ctx,
+		"INSERT INTO users (username, password, oidc_issuer, oidc_subject) VALUES($1, $2, $3, $4) RETURNING id",
+		username, UnusablePassword, issuer, subject)
+
+	var userID int64
+	err := row.Scan(&userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			err = ErrConflict
+		}
+		return userID, err
+	}
+
+	return userID, nil
+}
+
+// LinkOIDCSubject attaches an external identity to an existing user. It fails
+// with ErrConflict if the identity already belongs to another user.
+func (store *userStorage) LinkOIDCSubject(ctx context.Context, userID int64, issuer, subject string) error {
+	_, err := store.db.Exec(ctx,
+		"UPDATE users SET oidc_issuer = $2, oidc_subject = $3 WHERE id = $1",
+		userID, issuer, subject)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			err = ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (store *userStorage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	var isAdmin bool
+	err := store.db.QueryRow(ctx, "SELECT is_admin FROM users WHERE id = $1", userID).Scan(&isAdmin)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrNotFound
+		}
+		return false, err
+	}
+
+	return isAdmin, nil
+}
+
+func (store *userStorage) SetAdmin(ctx context.Context, userID int64, admin bool) error {
+	tag, err := store.db.Exec(ctx, "UPDATE users SET is_admin = $2 WHERE id = $1", userID, admin)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AnonymizeUser replaces the login with username, makes password and OpenID
+// Connect login impossible and invalidates every session of the user.
+func (store *userStorage) AnonymizeUser(ctx context.Context, userID int64, username string) error {
+	tag, err := store.db.Exec(ctx,
+		`UPDATE users SET username = $2, password = $3, oidc_issuer = NULL, oidc_subject = NULL,
+		is_admin = FALSE, token_version = token_version + 1 WHERE id = $1`,
+		userID, username, UnusablePassword)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
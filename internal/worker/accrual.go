@@ -0,0 +1,149 @@
+// Package worker contains background jobs that run alongside the HTTP server.
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/metrics"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+	"github.com/learies/gofermart/internal/tracing"
+)
+
+const accrualPollBatch = 100
+
+// accrualRepollDelay is how long an order waits before it is asked about
+// again, however often the poller runs, so that orders the accrual system
+// does not know yet do not crowd out the rest.
+const accrualRepollDelay = 30 * time.Second
+
+// AccrualPoller periodically asks the accrual system about orders whose
+// accrual is not final and records every change it learns about.
+type AccrualPoller struct {
+	orders   storage.OrderStorage
+	accrual  services.AccrualService
+	address  string
+	interval time.Duration
+	workers  atomic.Int32
+}
+
+func NewAccrualPoller(orders storage.OrderStorage, address string, interval time.Duration, workers int) *AccrualPoller {
+	p := &AccrualPoller{
+		orders:   orders,
+		accrual:  services.NewAccrualService(),
+		address:  address,
+		interval: interval,
+	}
+	p.SetWorkers(workers)
+	return p
+}
+
+// SetWorkers changes how many orders are polled concurrently, from the next
+// poll on.
+func (p *AccrualPoller) SetWorkers(workers int) {
+	p.workers.Store(int32(max(workers, 1)))
+}
+
+// Run polls until ctx is cancelled.
+func (p *AccrualPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.poll(ctx)
+		}
+	}
+}
+
+func (p *AccrualPoller) poll(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "accrual poll")
+	defer span.End()
+
+	orders, err := p.orders.ClaimPendingOrders(ctx, accrualPollBatch, time.Now().Add(-accrualRepollDelay))
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to get pending orders", "error", err)
+		return
+	}
+
+	// Отмена останавливает оставшиеся запросы, когда система начислений
+	// просит подождать
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slots := make(chan struct{}, p.workers.Load())
+	var wg sync.WaitGroup
+	for _, order := range orders {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(order models.Order) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if !p.pollOrder(ctx, order) {
+				cancel()
+			}
+		}(order)
+	}
+	wg.Wait()
+}
+
+// pollOrder updates one order and reports false when the accrual system asks
+// to slow down.
+func (p *AccrualPoller) pollOrder(ctx context.Context, order models.Order) bool {
+	orderChan, errChan := p.accrual.FetchOrder(ctx, p.address, order.OrderID)
+
+	select {
+	case info := <-orderChan:
+		status, ok := orderStatus(info.Status)
+		if !ok {
+			logger.Log.WarnContext(ctx, "Unknown accrual status", "order", order.OrderID, "status", info.Status)
+			return true
+		}
+		err := p.orders.UpdateOrderStatus(ctx, order.OrderID, status, info.Accrual, models.OrderEventSourceAccrualPoll)
+		if err != nil {
+			logger.Log.ErrorContext(ctx, "Failed to update order status", "order", order.OrderID, "error", err)
+			return true
+		}
+		// Опрашиваются только незавершённые заказы, поэтому начисление
+		// учитывается один раз
+		if status == "PROCESSED" {
+			metrics.PointsAccrued.Add(float64(info.Accrual))
+		}
+	case err := <-errChan:
+		if errors.Is(err, services.ErrorStatusTooManyRequests) {
+			// Продолжим на следующем тике
+			return false
+		}
+		if !errors.Is(err, services.ErrorOrderNotFound) && ctx.Err() == nil {
+			logger.Log.ErrorContext(ctx, "Failed to poll accrual", "order", order.OrderID, "error", err)
+		}
+	}
+	return true
+}
+
+// orderStatus maps an accrual system status onto an order status.
+func orderStatus(accrualStatus string) (string, bool) {
+	switch accrualStatus {
+	case "REGISTERED", "PROCESSING":
+		return "PROCESSING", true
+	case "INVALID", "PROCESSED":
+		return accrualStatus, true
+	}
+	return "", false
+}
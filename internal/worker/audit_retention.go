@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+const auditRetentionInterval = time.Hour
+
+// AuditRetention deletes audit events older than the retention period, once
+// at start and then every hour.
+type AuditRetention struct {
+	audit     storage.AuditStorage
+	retention time.Duration
+}
+
+func NewAuditRetention(audit storage.AuditStorage, retention time.Duration) *AuditRetention {
+	return &AuditRetention{
+		audit:     audit,
+		retention: retention,
+	}
+}
+
+// Run prunes until ctx is cancelled.
+func (j *AuditRetention) Run(ctx context.Context) {
+	ticker := time.NewTicker(auditRetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		j.prune(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *AuditRetention) prune(ctx context.Context) {
+	deleted, err := j.audit.DeleteAuditEventsBefore(ctx, time.Now().Add(-j.retention))
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to prune audit events", "error", err)
+		return
+	}
+	if deleted > 0 {
+		logger.Log.InfoContext(ctx, "Pruned audit events", "deleted", deleted, "retention", j.retention.String())
+	}
+}
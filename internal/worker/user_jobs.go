@@ -0,0 +1,283 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+)
+
+const (
+	userJobPollInterval = time.Second
+	userJobTimeout      = 5 * time.Minute
+	// A job still running after this long is assumed to belong to a crashed
+	// instance and is run again.
+	userJobStaleAfter = 2 * userJobTimeout
+
+	// userJobRetention is how long finished jobs, and with them exported
+	// archives, are kept.
+	userJobRetention     = 24 * time.Hour
+	userJobPruneInterval = time.Hour
+	exportOrdersPageSize = 1000
+	deletionTxRetries    = 3
+)
+
+// UserJobs runs data exports and account deletions queued by users.
+type UserJobs struct {
+	store   *storage.Storage
+	auditor services.AuditEmitter
+}
+
+func NewUserJobs(store *storage.Storage) *UserJobs {
+	return &UserJobs{
+		store:   store,
+		auditor: services.NewAuditEmitter(store.Audit),
+	}
+}
+
+// Run executes queued jobs until ctx is cancelled.
+func (w *UserJobs) Run(ctx context.Context) {
+	ticker := time.NewTicker(userJobPollInterval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for w.runNext(ctx) {
+		}
+
+		if time.Since(pruned) >= userJobPruneInterval {
+			w.prune(ctx)
+			pruned = time.Now()
+		}
+	}
+}
+
+// runNext runs one queued job and reports whether there was one.
+func (w *UserJobs) runNext(ctx context.Context) bool {
+	job, err := w.store.Jobs.ClaimJob(ctx, time.Now().Add(-userJobStaleAfter))
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			logger.Log.ErrorContext(ctx, "Failed to claim user job", "error", err)
+		}
+		return false
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, userJobTimeout)
+	defer cancel()
+
+	var result []byte
+	switch job.Kind {
+	case models.JobKindExport:
+		result, err = w.export(jobCtx, job.UserID)
+	case models.JobKindDelete:
+		err = w.delete(jobCtx, job.UserID)
+	default:
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+
+	status, message := models.JobStatusDone, ""
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "User job failed", "job", job.ID, "kind", job.Kind, "user_id", job.UserID, "error", err)
+		// The status is visible to anyone who knows the job ID, so the
+		// details stay in the log.
+		status, message = models.JobStatusFailed, "internal error"
+	}
+
+	if err := w.store.Jobs.FinishJob(ctx, job.ID, status, message, result); err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to finish user job", "job", job.ID, "error", err)
+	}
+	return true
+}
+
+// export builds a ZIP archive with the user's profile, orders, withdrawals
+// and balance ledger.
+func (w *UserJobs) export(ctx context.Context, userID int64) ([]byte, error) {
+	user, err := w.store.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	totp, err := w.store.TOTP.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := w.store.APIKeys.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+
+	allWithdrawals, err := w.store.Balance.GetWithdrawalsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	withdrawals := []models.UserWithdrawal{}
+	withdrawalNumbers := make(map[string]struct{})
+	if allWithdrawals != nil {
+		for _, withdrawal := range *allWithdrawals {
+			if withdrawal.Withdrawn > 0 {
+				withdrawals = append(withdrawals, withdrawal)
+				withdrawalNumbers[withdrawal.OrderNumber] = struct{}{}
+			}
+		}
+	}
+
+	orders, err := w.userOrders(ctx, userID, withdrawalNumbers)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", models.UserProfile{
+			ID:               user.ID,
+			Login:            user.Username,
+			TwoFactorEnabled: totp.Enabled,
+			APIKeys:          keys,
+		}},
+		{"orders.json", orders},
+		{"withdrawals.json", withdrawals},
+		{"ledger.json", ledger(orders, withdrawals)},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// userOrders returns the uploaded orders of the user, oldest first. Withdrawals
+// are stored as orders too; they are listed by their own file and skipped.
+func (w *UserJobs) userOrders(ctx context.Context, userID int64, withdrawals map[string]struct{}) ([]models.OrderResponse, error) {
+	orders := []models.OrderResponse{}
+	query := models.OrderQuery{Ascending: true, Limit: exportOrdersPageSize}
+	for {
+		page, err := w.store.Orders.ListUserOrders(ctx, userID, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, order := range page {
+			if _, ok := withdrawals[order.OrderID]; !ok {
+				orders = append(orders, order)
+			}
+		}
+		if len(page) < query.Limit {
+			return orders, nil
+		}
+
+		last := page[len(page)-1]
+		query.After = &models.OrderCursor{UploadedAt: last.UploadedAt, OrderID: last.OrderID}
+	}
+}
+
+// ledger lists accruals and withdrawals in the order they happened.
+func ledger(orders []models.OrderResponse, withdrawals []models.UserWithdrawal) []models.LedgerEntry {
+	entries := []models.LedgerEntry{}
+	for _, order := range orders {
+		if order.Accrual > 0 {
+			entries = append(entries, models.LedgerEntry{
+				OrderNumber: order.OrderID,
+				Type:        models.LedgerAccrual,
+				Amount:      order.Accrual,
+				At:          order.UploadedAt,
+			})
+		}
+	}
+	for _, withdrawal := range withdrawals {
+		entries = append(entries, models.LedgerEntry{
+			OrderNumber: withdrawal.OrderNumber,
+			Type:        models.LedgerWithdrawal,
+			Amount:      -withdrawal.Withdrawn,
+			At:          withdrawal.UploadedAt,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries
+}
+
+// delete anonymises the account. Orders and their history stay for
+// accounting, and audit events stay without the login, IP addresses and user
+// agents; credentials, second factors, API keys and exported archives are
+// dropped, and every session stops working.
+func (w *UserJobs) delete(ctx context.Context, userID int64) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	login := fmt.Sprintf("deleted-%d-%s", userID, hex.EncodeToString(suffix))
+
+	opts := storage.TxOptions{Isolation: storage.ReadCommitted, MaxRetries: deletionTxRetries}
+	err := w.store.Tx.WithinTx(ctx, opts, func(ctx context.Context, tx *storage.Storage) error {
+		user, err := tx.Users.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Users.AnonymizeUser(ctx, userID, login); err != nil {
+			return err
+		}
+		if err := tx.Audit.PseudonymizeAuditEvents(ctx, userID, user.Username); err != nil {
+			return err
+		}
+		if err := tx.TOTP.DisableTOTP(ctx, userID); err != nil {
+			return err
+		}
+		if err := tx.APIKeys.RevokeAllAPIKeys(ctx, userID); err != nil {
+			return err
+		}
+		return tx.Jobs.ClearJobResults(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	w.auditor.Emit(ctx, models.AuditEvent{Type: models.AuditAccountDeleted, UserID: userID})
+	return nil
+}
+
+func (w *UserJobs) prune(ctx context.Context) {
+	deleted, err := w.store.Jobs.DeleteJobsBefore(ctx, time.Now().Add(-userJobRetention))
+	if err != nil {
+		logger.Log.ErrorContext(ctx, "Failed to prune user jobs", "error", err)
+		return
+	}
+	if deleted > 0 {
+		logger.Log.InfoContext(ctx, "Pruned user jobs", "deleted", deleted)
+	}
+}
@@ -0,0 +1,228 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/learies/gofermart/internal/config/logger"
+	"github.com/learies/gofermart/internal/models"
+	"github.com/learies/gofermart/internal/services"
+	"github.com/learies/gofermart/internal/storage"
+	"github.com/learies/gofermart/internal/storage/memory"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.NewLogger(logger.Options{Level: "error", Format: "text", Output: "stderr"}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newUserJobsTest(t *testing.T) (*UserJobs, *storage.Storage, int64) {
+	t.Helper()
+
+	store := memory.New(services.NewAuthService(services.HashOptions{BcryptCost: 4}))
+	userID, err := store.Users.CreateUser(context.Background(), "alice", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUserJobs(store), store, userID
+}
+
+// runJob queues a job of kind for userID, runs it and returns it finished.
+func runJob(t *testing.T, w *UserJobs, userID int64, kind string) *models.Job {
+	t.Helper()
+	ctx := context.Background()
+
+	job := &models.Job{ID: kind + "-job", UserID: userID, Kind: kind, Status: models.JobStatusPending}
+	if err := w.store.Jobs.CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if !w.runNext(ctx) {
+		t.Fatal("runNext found no job")
+	}
+
+	finished, err := w.store.Jobs.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished.Status != models.JobStatusDone {
+		t.Fatalf("job status = %q (%s), want %q", finished.Status, finished.Error, models.JobStatusDone)
+	}
+	return finished
+}
+
+func TestExportJob(t *testing.T) {
+	w, store, userID := newUserJobsTest(t)
+	ctx := context.Background()
+
+	for _, order := range []models.Order{
+		{OrderID: "12345678903", Status: "PROCESSED", Accrual: 500, UserID: userID},
+		{OrderID: "9278923470", Status: "NEW", UserID: userID},
+		{OrderID: "2377225624", Status: "NEW", Withdrawn: 120, UserID: userID},
+	} {
+		if err := store.Orders.CreateOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job := runJob(t, w, userID, models.JobKindExport)
+	result, err := store.Jobs.GetJobResult(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readArchive(t, result)
+
+	var profile models.UserProfile
+	decodeFile(t, files, "profile.json", &profile)
+	if profile.ID != userID || profile.Login != "alice" || profile.TwoFactorEnabled || profile.APIKeys == nil {
+		t.Errorf("profile = %+v", profile)
+	}
+
+	var orders []models.OrderResponse
+	decodeFile(t, files, "orders.json", &orders)
+	if got := orderNumbers(orders); got != "12345678903 9278923470" {
+		t.Errorf("orders.json lists %q, want the uploaded orders without the withdrawal", got)
+	}
+
+	var withdrawals []models.UserWithdrawal
+	decodeFile(t, files, "withdrawals.json", &withdrawals)
+	if len(withdrawals) != 1 || withdrawals[0].OrderNumber != "2377225624" || withdrawals[0].Withdrawn != 120 {
+		t.Errorf("withdrawals.json = %+v, want the withdrawal of 120", withdrawals)
+	}
+
+	var entries []models.LedgerEntry
+	decodeFile(t, files, "ledger.json", &entries)
+	if len(entries) != 2 ||
+		entries[0].Type != models.LedgerAccrual || entries[0].Amount != 500 ||
+		entries[1].Type != models.LedgerWithdrawal || entries[1].Amount != -120 {
+		t.Errorf("ledger.json = %+v, want the accrual of 500 and then the withdrawal of 120", entries)
+	}
+}
+
+func TestDeleteJob(t *testing.T) {
+	w, store, userID := newUserJobsTest(t)
+	ctx := context.Background()
+
+	if err := store.Audit.RecordAuditEvent(ctx, &models.AuditEvent{
+		Type:      models.AuditLoginSucceeded,
+		UserID:    userID,
+		IP:        "192.0.2.1",
+		UserAgent: "curl/8.0",
+		Details:   map[string]string{"login": "alice"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// A failed login names the account only by its login.
+	if err := store.Audit.RecordAuditEvent(ctx, &models.AuditEvent{
+		Type:    models.AuditLoginFailed,
+		IP:      "192.0.2.2",
+		Details: map[string]string{"login": "alice", "reason": "invalid_credentials"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.APIKeys.CreateAPIKey(ctx, &models.APIKey{UserID: userID, Name: "script", Scopes: []string{models.ScopeOrdersRead}}, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TOTP.SaveTOTPSecret(ctx, userID, "secret", nil); err != nil {
+		t.Fatal(err)
+	}
+	versionBefore, err := store.Users.GetTokenVersion(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runJob(t, w, userID, models.JobKindDelete)
+
+	user, err := store.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(user.Username, "deleted-") || user.Password != storage.UnusablePassword {
+		t.Errorf("user = %q with password %q, want it anonymised", user.Username, user.Password)
+	}
+	if _, err := store.Users.GetUserByUsername(ctx, "alice"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetUserByUsername(alice) error = %v, want ErrNotFound", err)
+	}
+	if user.TokenVersion <= versionBefore {
+		t.Errorf("token version = %d, want it bumped from %d", user.TokenVersion, versionBefore)
+	}
+
+	if keys, err := store.APIKeys.ListAPIKeys(ctx, userID); err != nil || len(keys) != 0 {
+		t.Errorf("API keys = %+v, %v; want none", keys, err)
+	}
+	if totp, err := store.TOTP.GetTOTP(ctx, userID); err != nil || totp.Secret != "" {
+		t.Errorf("TOTP = %+v, %v; want it removed", totp, err)
+	}
+
+	events, err := store.Audit.ListAuditEvents(ctx, models.AuditQuery{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("audit has %d events, want the two recorded and account_deleted", len(events))
+	}
+	var deleted bool
+	for _, event := range events {
+		if event.Type == models.AuditAccountDeleted {
+			deleted = event.UserID == userID
+			continue
+		}
+		if event.IP != "" || event.UserAgent != "" || event.Details["login"] != "" {
+			t.Errorf("%s event = %+v, want it pseudonymised", event.Type, event)
+		}
+	}
+	if !deleted {
+		t.Error("no account_deleted audit event for the user")
+	}
+}
+
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = content
+	}
+	return files
+}
+
+func decodeFile(t *testing.T, files map[string][]byte, name string, v any) {
+	t.Helper()
+
+	content, ok := files[name]
+	if !ok {
+		t.Fatalf("archive has no %s", name)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func orderNumbers(orders []models.OrderResponse) string {
+	numbers := make([]string, len(orders))
+	for i, order := range orders {
+		numbers[i] = order.OrderID
+	}
+	return strings.Join(numbers, " ")
+}